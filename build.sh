@@ -17,7 +17,7 @@ create_exe_archive() {
   OUTPUT=$1
 
   echo "[*] Creating archive $OUTPUT ..."
-  zip -j "$OUTPUT" gitrob.exe ../README.md ../LICENSE.txt ../contentsignatures.json ../filesignatures.json >/dev/null
+  zip -j "$OUTPUT" gitrob.exe ../README.md ../LICENSE.txt ../contentsignatures.json ../filesignatures.json ../keyvaluesignatures.json ../compositesignatures.json >/dev/null
   rm -rf gitrob gitrob.exe
 }
 
@@ -27,7 +27,7 @@ create_archive() {
   OUTPUT=$1
 
   echo "[*] Creating archive $OUTPUT ..."
-  zip -j "$OUTPUT" gitrob ../README.md ../LICENSE.md ../contentsignatures.json ../filesignatures.json >/dev/null
+  zip -j "$OUTPUT" gitrob ../README.md ../LICENSE.md ../contentsignatures.json ../filesignatures.json ../keyvaluesignatures.json ../compositesignatures.json >/dev/null
   rm -rf gitrob gitrob.exe
 }
 
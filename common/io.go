@@ -1,6 +1,11 @@
 package common
 
-import "os"
+import (
+	"bytes"
+	"os"
+)
+
+const binarySniffLength = 8000
 
 func FileExists(path string) bool {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
@@ -8,3 +13,12 @@ func FileExists(path string) bool {
 	}
 	return true
 }
+
+// IsBinary uses the same heuristic as git: content is considered binary when
+// a NUL byte is present near its beginning.
+func IsBinary(data []byte) bool {
+	if len(data) > binarySniffLength {
+		data = data[:binarySniffLength]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
@@ -4,14 +4,20 @@ import (
 	"fmt"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
+	"io/ioutil"
+	"net/url"
+	"strings"
 )
 
 const (
 	TargetTypeUser         = "User"
 	TargetTypeOrganization = "Organization"
 	EmptyTreeCommitID      = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	ProviderGitHub         = "github"
+	ProviderGitLab         = "gitlab"
 )
 
 type CloneConfiguration struct {
@@ -24,6 +30,7 @@ type CloneConfiguration struct {
 }
 
 type Owner struct {
+	Provider  *string
 	Login     *string
 	ID        *int64
 	Type      *string
@@ -38,6 +45,7 @@ type Owner struct {
 }
 
 type Repository struct {
+	Provider      *string
 	Owner         *string
 	ID            *int64
 	Name          *string
@@ -49,6 +57,22 @@ type Repository struct {
 	Homepage      *string
 }
 
+// ProviderFromURL is the provider hosting a URL, or an empty string if it's
+// neither github.com nor gitlab.com.
+func ProviderFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	switch strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") {
+	case "github.com":
+		return ProviderGitHub
+	case "gitlab.com":
+		return ProviderGitLab
+	}
+	return ""
+}
+
 func getParentCommit(commit *object.Commit, repo *git.Repository) (*object.Commit, error) {
 	if commit.NumParents() == 0 {
 		parentCommit, err := repo.CommitObject(plumbing.NewHash(EmptyTreeCommitID))
@@ -136,7 +160,42 @@ func GetChangePath(change *object.Change) string {
 	return change.To.Name
 }
 
-func GetChangeContent(change *object.Change) (result string, contentError error) {
+// ChangeContent is the content of a change: the chunks of its patch, deleted
+// lines included, joined into Text.
+type ChangeContent struct {
+	Text   string
+	chunks []changeChunk
+}
+
+type changeChunk struct {
+	// end is the offset in Text where the chunk ends.
+	end int
+	// inFile is whether the lines of the chunk are in the file after the
+	// change.
+	inFile bool
+}
+
+// Line returns the line, counting from 1, that holds offset in Text in the
+// file after the change, or 0 if the offset is in deleted lines. Lines of
+// deleted files are counted in the file before the change.
+func (c ChangeContent) Line(offset int) int {
+	line, start := 1, 0
+	for _, chunk := range c.chunks {
+		if offset < chunk.end {
+			if !chunk.inFile {
+				return 0
+			}
+			return line + strings.Count(c.Text[start:offset], "\n")
+		}
+		if chunk.inFile {
+			line += strings.Count(c.Text[start:chunk.end], "\n")
+		}
+		start = chunk.end
+	}
+	return 0
+}
+
+func GetChangeContent(change *object.Change) (result ChangeContent, contentError error) {
 	// temporary response to:  https://github.com/sergi/go-diff/issues/89
 	defer func() {
 		if err := recover(); err != nil {
@@ -145,15 +204,58 @@ func GetChangeContent(change *object.Change) (result string, contentError error)
 	}()
 	patch, err := change.Patch()
 	if err != nil {
-		return "", err
+		return ChangeContent{}, err
 	}
+	var text strings.Builder
+	deleted := true
 	for _, filePatch := range patch.FilePatches() {
 		if filePatch.IsBinary() {
 			continue
 		}
 		for _, chunk := range filePatch.Chunks() {
-			result += chunk.Content()
+			text.WriteString(chunk.Content())
+			inFile := chunk.Type() != diff.Delete
+			deleted = deleted && !inFile
+			result.chunks = append(result.chunks, changeChunk{end: text.Len(), inFile: inFile})
+		}
+	}
+	if deleted {
+		for i := range result.chunks {
+			result.chunks[i].inFile = true
 		}
 	}
+	result.Text = text.String()
 	return result, nil
 }
+
+func GetChangeFile(change *object.Change) (*object.File, error) {
+	from, to, err := change.Files()
+	if err != nil {
+		return nil, err
+	}
+	if to != nil {
+		return to, nil
+	}
+	if from != nil {
+		return from, nil
+	}
+	return nil, fmt.Errorf("change has no file: %s", change.String())
+}
+
+func GetChangeFileContent(change *object.Change, maxSize int64) ([]byte, error) {
+	file, err := GetChangeFile(change)
+	if err != nil {
+		return nil, err
+	}
+	if file.Size > maxSize {
+		return nil, fmt.Errorf("file %s is larger than %d bytes", file.Name, maxSize)
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	return ioutil.ReadAll(reader)
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// testChange commits a README and then each content of a file in turn, an
+// empty one removing it, and returns the change of the last commit.
+func testChange(t *testing.T, contents ...string) *object.Change {
+	t.Helper()
+	fs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commit *object.Commit
+	for i, content := range append([]string{"# acme\n"}, contents...) {
+		name := "config.env"
+		if i == 0 {
+			name = "README.md"
+		}
+		if content == "" {
+			_, err = worktree.Remove(name)
+		} else if err = util.WriteFile(fs, name, []byte(content), 0644); err == nil {
+			_, err = worktree.Add(name)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := worktree.Commit("Update config", &git.CommitOptions{
+			Author: &object.Signature{Name: "Jane", Email: "jane@acme.example", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commit, err = repo.CommitObject(hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes, err := GetChanges(commit, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(changes))
+	}
+	return changes[0]
+}
+
+func TestChangeContentLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents []string
+		text     string
+		want     int
+	}{
+		{"added file", []string{"a=1\nb=2\nsecret=3\n"}, "secret", 3},
+		{"added line", []string{"a=1\nold=2\nc=3\n", "a=1\nold=2\nc=3\nsecret=4\n"}, "secret", 4},
+		{"after deleted lines", []string{"a=1\nold=2\nc=3\nsecret=4\n", "a=1\nc=3\nsecret=4\n"}, "secret", 3},
+		{"deleted line", []string{"a=1\nsecret=2\nc=3\n", "a=1\nc=3\n"}, "secret", 0},
+		{"deleted file", []string{"a=1\nsecret=2\n", ""}, "secret", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := GetChangeContent(testChange(t, test.contents...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			offset := strings.Index(content.Text, test.text)
+			if offset < 0 {
+				t.Fatalf("%q isn't in the change content %q", test.text, content.Text)
+			}
+			if got := content.Line(offset); got != test.want {
+				t.Errorf("Line = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"gitrob/github"
 	"gitrob/gitlab"
 	"gitrob/matching"
+	"gitrob/verification"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"os"
@@ -15,6 +16,23 @@ import (
 
 func PrintSessionStats(sess *Session) {
 	sess.Out.Infof("\nFindings....: %d\n", sess.Stats.Findings)
+	if sess.Stats.Findings > 0 {
+		counts := make(map[string]int)
+		findings, err := sess.QueryFindings(nil)
+		if err != nil {
+			sess.Out.Errorf("Errorf reading findings: %s\n", err)
+		}
+		for _, finding := range findings {
+			counts[finding.Severity]++
+		}
+		for _, severity := range []string{matching.SeverityCritical, matching.SeverityHigh, matching.SeverityMedium,
+			matching.SeverityLow, matching.SeverityInfo} {
+			if counts[severity] > 0 {
+				sess.Out.Infof("  %-10s: %d\n", severity, counts[severity])
+			}
+		}
+	}
+	sess.Out.Infof("Suppressed..: %d\n", sess.Stats.Suppressed)
 	sess.Out.Infof("Files.......: %d\n", sess.Stats.Files)
 	sess.Out.Infof("Commits.....: %d\n", sess.Stats.Commits)
 	sess.Out.Infof("Repositories: %d\n", sess.Stats.Repositories)
@@ -105,27 +123,47 @@ func deletePath(path, cloneURL string, threadID int, sess *Session) {
 	}
 }
 
-func createFinding(repo common.Repository, commit *object.Commit, change *object.Change,
-	fileSignature matching.FileSignature, contentSignature matching.ContentSignature,
-	repositoryURL, commitURL string) (*matching.Finding, error) {
+const maxKeyFileSize = 1048576
+
+type changeContext struct {
+	repo          *common.Repository
+	commit        *object.Commit
+	change        *object.Change
+	repositoryURL string
+	commitURL     string
+	threadID      int
+	content       func() (string, error)
+	blob          func() ([]byte, error)
+	// line returns the line of the file that holds an offset in content, or 0
+	// if it isn't in the file.
+	line func(offset int) int
+}
+
+func createFinding(ctx *changeContext, path string,
+	fileSignature, contentSignature matching.Signature) (*matching.Finding, error) {
 	f := &matching.Finding{
-		FilePath:                    common.GetChangePath(change),
-		Action:                      common.GetChangeAction(change),
+		FilePath:                    path,
+		Action:                      common.GetChangeAction(ctx.change),
+		Category:                    matching.CategorySecret,
+		FileSignatureID:             fileSignature.GetID(),
 		FileSignatureDescription:    fileSignature.GetDescription(),
 		FileSignatureComment:        fileSignature.GetComment(),
+		ContentSignatureID:          contentSignature.GetID(),
 		ContentSignatureDescription: contentSignature.GetDescription(),
 		ContentSignatureComment:     contentSignature.GetComment(),
-		RepositoryOwner:             *repo.Owner,
-		RepositoryName:              *repo.Name,
-		CommitHash:                  commit.Hash.String(),
-		CommitMessage:               strings.TrimSpace(commit.Message),
-		CommitAuthor:                commit.Author.String(),
-		CloneURL:                    *repo.CloneURL,
-		RepositoryURL:               repositoryURL,
-		CommitURL:                   commitURL,
+		RepositoryOwner:             *ctx.repo.Owner,
+		RepositoryName:              *ctx.repo.Name,
+		CommitHash:                  ctx.commit.Hash.String(),
+		CommitMessage:               strings.TrimSpace(ctx.commit.Message),
+		CommitAuthor:                ctx.commit.Author.String(),
+		CloneURL:                    *ctx.repo.CloneURL,
+		RepositoryURL:               ctx.repositoryURL,
+		CommitURL:                   ctx.commitURL,
 	}
+	f.Severity, f.Confidence = matching.FindingRating(fileSignature, contentSignature)
 
-	f.FileURL = fmt.Sprintf("%s/blob/%s/%s", f.RepositoryURL, f.CommitHash, f.FilePath)
+	filePath, _ := matching.SplitArchivePath(f.FilePath)
+	f.FileURL = fmt.Sprintf("%s/blob/%s/%s", f.RepositoryURL, f.CommitHash, filePath)
 	id, err := f.GenerateID()
 	if err != nil {
 		return nil, err
@@ -134,41 +172,207 @@ func createFinding(repo common.Repository, commit *object.Commit, change *object
 	return f, err
 }
 
-func matchContent(sess *Session,
-	matchTarget matching.MatchTarget,
-	repo common.Repository,
-	change *object.Change,
-	commit *object.Commit,
-	repositoryURL, commitURL string,
-	fileSignature matching.FileSignature,
-	threadID int) {
-	content, err := common.GetChangeContent(change)
-	if err != nil {
-		sess.Out.Errorf("Errorf retrieving content in commit %s, change %s:  %s", commit.String(), change.String(), err)
+// inspectMatch runs the inspectors on the match and applies what they found:
+// verified secrets are raised to high confidence, and public keys,
+// certificates and keys that don't parse are downgraded unless verified.
+func inspectMatch(sess *Session, ctx *changeContext, file *matching.File, match *matching.Match,
+	finding *matching.Finding) {
+	for _, inspector := range sess.Matchers.Inspectors {
+		if err := inspector.Inspect(file, match); err != nil {
+			sess.Out.Debugf("[THREAD #%d][%s] Errorf inspecting %s with %s: %s\n", ctx.threadID, *ctx.repo.CloneURL,
+				finding.FilePath, inspector.Name(), err)
+		}
+	}
+	if match.VerificationStatus != "" {
+		finding.Verifier = match.Verifier
+		finding.VerificationStatus = match.VerificationStatus
+		if finding.VerificationStatus == verification.StatusValid {
+			finding.Confidence = matching.ConfidenceHigh
+		}
+	}
+	if metadata := match.KeyMetadata; metadata != nil {
+		finding.KeyMetadata = metadata
+		finding.Downgraded = (!metadata.Private || !metadata.Valid) &&
+			finding.VerificationStatus != verification.StatusValid
+		if finding.Downgraded {
+			finding.Severity = matching.SeverityInfo
+			finding.Confidence = matching.ConfidenceLow
+		}
 	}
-	matchTarget.Content = content
-	sess.Out.Debugf("[THREAD #%d][%s] Matching content in %s...\n", threadID, *repo.CloneURL, commit.Hash)
-	for _, contentSignature := range sess.Signatures.ContentSignatures {
-		matched, err := contentSignature.Match(matchTarget)
+}
+
+// matchSignatures runs the file matchers on the target and, when the mode
+// selects the file for content matching, the content matchers.
+func matchSignatures(sess *Session, ctx *changeContext, matchTarget matching.MatchTarget) {
+	file := matching.NewFile(matchTarget, ctx.content, ctx.blob, *sess.Options.DecodeDepth)
+	runMatchers(sess, ctx, file, sess.Matchers.File)
+
+	switch *sess.Options.Mode {
+	case matching.ModeFileMatch:
+		return
+	case matching.ModeMixed:
+		fileSignature, err := sess.Signatures.MatchFile(matchTarget)
 		if err != nil {
-			sess.Out.Errorf("Errorf while performing content match with '%s': %s\n", contentSignature.Description, err)
+			sess.Out.Errorf("Errorf while performing file match: %s\n", err)
 		}
-		if !matched {
-			continue
+		if fileSignature == nil {
+			return
 		}
+		file.FileSignature = fileSignature
+	}
+
+	if sess.Signatures.IsContentExcluded(matchTarget) {
+		sess.Out.Debugf("[THREAD #%d][%s] Skipping content of excluded file %s\n", ctx.threadID, *ctx.repo.CloneURL, matchTarget.Path)
+		return
+	}
+	if _, err := file.Content(); err != nil {
+		sess.Out.Errorf("Errorf retrieving content in commit %s, change %s:  %s", ctx.commit.String(), ctx.change.String(), err)
+		return
+	}
+	sess.Out.Debugf("[THREAD #%d][%s] Matching content in %s...\n", ctx.threadID, *ctx.repo.CloneURL, ctx.commit.Hash)
+	runMatchers(sess, ctx, file, sess.Matchers.Content)
+}
 
-		finding, err := createFinding(repo, commit, change, fileSignature, contentSignature, repositoryURL, commitURL)
+func runMatchers(sess *Session, ctx *changeContext, file *matching.File, matchers []matching.Matcher) {
+	for _, matcher := range matchers {
+		matches, err := matcher.Match(file)
 		if err != nil {
-			sess.Out.Errorf("Errorf while performing content match with '%s': %s\n", contentSignature.Description, err)
-		} else {
-			sess.AddFinding(finding)
+			sess.Out.Errorf("Errorf while matching %s with %s: %s\n", file.Target.Path, matcher.Name(), err)
+		}
+		for _, match := range matches {
+			reportMatch(sess, ctx, file, match)
+		}
+	}
+}
+
+// reportMatch turns a match into a finding, unless the code suppresses it
+// with a gitrob:allow annotation.
+func reportMatch(sess *Session, ctx *changeContext, file *matching.File, match matching.Match) {
+	var fileSignature, contentSignature matching.Signature = matching.FileSignature{Description: "NA"},
+		matching.ContentSignature{Description: "NA"}
+	if match.FileSignature != nil {
+		fileSignature = match.FileSignature
+	} else if file.FileSignature != nil {
+		fileSignature = *file.FileSignature
+	}
+	if match.ContentSignature != nil {
+		contentSignature = match.ContentSignature
+	}
+	finding, err := createFinding(ctx, file.Target.Path, fileSignature, contentSignature)
+	if err != nil {
+		sess.Out.Errorf("Errorf while creating finding for %s: %s\n", file.Target.Path, err)
+		return
+	}
+	sess.Signatures.OverrideFinding(finding)
+	finding.ConfigKey = match.ConfigKey
+	finding.EncodingChain = match.EncodingChain
+	finding.JWT = match.JWT
+	finding.RedactedValue = match.RedactedValue
+	if match.Category != "" {
+		finding.Category = match.Category
+	}
+
+	text := match.Text
+	var loc []int
+	var suppression *matching.Suppression
+	if len(match.Locations) > 0 {
+		loc = match.Locations[0]
+		if !*sess.Options.IgnoreSuppressions {
+			if unsuppressed, s := matching.FirstUnsuppressed(match.Content, match.Locations, contentSignature.GetID()); s == nil {
+				loc = unsuppressed
+			} else {
+				suppression = s
+			}
+		}
+		text = match.Content[loc[0]:loc[1]]
+	}
+	if finding.Fingerprint, err = finding.GenerateFingerprint(text, sess.fingerprintKey); err != nil {
+		sess.Out.Errorf("Errorf while creating finding for %s: %s\n", file.Target.Path, err)
+		return
+	}
+	if suppression != nil {
+		finding.Suppression = suppression
+		sess.AddSuppressedFinding(finding)
+		return
+	}
+	if loc != nil {
+		match.Locations = [][]int{loc}
+		// decoded content has no lines in the file
+		if len(match.EncodingChain) == 0 {
+			finding.Line = ctx.line(loc[0])
 		}
 	}
+	match.Text = text
+	inspectMatch(sess, ctx, file, &match, finding)
+	sess.AddFinding(finding)
+}
+
+func findArchiveSecrets(sess *Session, ctx *changeContext, path string) {
+	data, err := common.GetChangeFileContent(ctx.change, *sess.Options.ArchiveMaxSize)
+	if err != nil {
+		sess.Out.Debugf("[THREAD #%d][%s] Unable to read archive %s: %s\n", ctx.threadID, *ctx.repo.CloneURL, path, err)
+		return
+	}
+	members, skipped, err := matching.ExpandArchive(path, data, matching.ArchiveLimits{
+		MaxSize:  *sess.Options.ArchiveMaxSize,
+		MaxDepth: *sess.Options.ArchiveMaxDepth,
+	})
+	for _, reason := range skipped {
+		sess.Out.Warnf("[THREAD #%d][%s] Skipped archive member %s\n", ctx.threadID, *ctx.repo.CloneURL, reason)
+	}
+	if err != nil {
+		sess.Out.Warnf("[THREAD #%d][%s] Unable to fully unpack archive %s: %s\n", ctx.threadID, *ctx.repo.CloneURL, path, err)
+	}
+	sess.Out.Debugf("[THREAD #%d][%s] Unpacked %d files from %s\n", ctx.threadID, *ctx.repo.CloneURL, len(members), path)
+
+	for _, member := range members {
+		matchTarget := matching.NewMatchTarget(member.Path)
+		if matchTarget.IsSkippable() {
+			sess.Out.Debugf("[THREAD #%d][%s] Skipping %s\n", ctx.threadID, *ctx.repo.CloneURL, matchTarget.Path)
+			continue
+		}
+		member := member
+		memberCtx := *ctx
+		memberCtx.content = func() (string, error) {
+			if common.IsBinary(member.Content) {
+				return "", nil
+			}
+			return string(member.Content), nil
+		}
+		memberCtx.blob = func() ([]byte, error) {
+			return member.Content, nil
+		}
+		memberCtx.line = func(offset int) int {
+			return matching.LineNumber(string(member.Content), offset)
+		}
+		matchSignatures(sess, &memberCtx, matchTarget)
+		sess.Stats.IncrementFiles()
+	}
 }
 
 func findSecrets(sess *Session, repo *common.Repository, commit *object.Commit, changes object.Changes, threadID int,
 	repositoryURL, commitURL string) {
 	for _, change := range changes {
+		ctx := &changeContext{
+			repo:          repo,
+			commit:        commit,
+			change:        change,
+			repositoryURL: repositoryURL,
+			commitURL:     commitURL,
+			threadID:      threadID,
+		}
+		var content common.ChangeContent
+		ctx.content = func() (string, error) {
+			var err error
+			content, err = common.GetChangeContent(ctx.change)
+			return content.Text, err
+		}
+		ctx.line = func(offset int) int {
+			return content.Line(offset)
+		}
+		ctx.blob = func() ([]byte, error) {
+			return common.GetChangeFileContent(ctx.change, maxKeyFileSize)
+		}
 		path := common.GetChangePath(change)
 		matchTarget := matching.NewMatchTarget(path)
 		if matchTarget.IsSkippable() {
@@ -177,38 +381,11 @@ func findSecrets(sess *Session, repo *common.Repository, commit *object.Commit,
 		}
 		sess.Out.Debugf("[THREAD #%d][%s] Inspecting file: %s...\n", threadID, *repo.CloneURL, matchTarget.Path)
 
-		if *sess.Options.Mode != matching.ModeContentMatch {
-			for _, fileSignature := range sess.Signatures.FileSignatures {
-				matched, err := fileSignature.Match(matchTarget)
-				if err != nil {
-					sess.Out.Errorf(fmt.Sprintf("Errorf while performing file match: %s\n", err))
-				}
-				if !matched {
-					continue
-				}
-
-				if *sess.Options.Mode == matching.ModeFileMatch {
-					finding, err := createFinding(*repo, commit, change, fileSignature,
-						matching.ContentSignature{Description: "NA"}, repositoryURL, commitURL)
-					if err != nil {
-						sess.Out.Errorf(fmt.Sprintf("Errorf while performing file match: %s\n", err))
-					} else {
-						sess.AddFinding(finding)
-					}
-				}
+		matchSignatures(sess, ctx, matchTarget)
+		sess.Stats.IncrementFiles()
 
-				if *sess.Options.Mode == matching.ModeMixed {
-					matchContent(sess, matchTarget, *repo, change, commit, repositoryURL, commitURL, fileSignature,
-						threadID)
-				}
-
-				break
-			}
-			sess.Stats.IncrementFiles()
-		} else {
-			matchContent(sess, matchTarget, *repo, change, commit, repositoryURL, commitURL,
-				matching.FileSignature{Description: "NA"}, threadID)
-			sess.Stats.IncrementFiles()
+		if *sess.Options.ArchiveMaxDepth > 0 && matching.IsArchive(path) {
+			findArchiveSecrets(sess, ctx, path)
 		}
 	}
 }
@@ -252,6 +429,7 @@ func getRepositoryHistory(sess *Session, clone *git.Repository, repo *common.Rep
 	history, err := common.GetRepositoryHistory(clone)
 	if err != nil {
 		sess.Out.Errorf("[THREAD #%d][%s] Errorf getting commit history: %s\n", threadID, *repo.CloneURL, err)
+		sess.FlushFindings()
 		deletePath(path, *repo.CloneURL, threadID, sess)
 		sess.Stats.IncrementRepositories()
 		sess.Stats.UpdateProgress(sess.Stats.Repositories, len(sess.Repositories))
@@ -0,0 +1,498 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gitrob/common"
+	"gitrob/matching"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Commands maps the names of subcommands to their implementations. Any other
+// first argument is treated as a target.
+var Commands = map[string]func(args []string) error{
+	"diff":       diffCommand,
+	"export":     exportCommand,
+	"merge":      mergeCommand,
+	"migrate":    migrateCommand,
+	"records":    recordsCommand,
+	"report":     reportCommand,
+	"signatures": signaturesCommand,
+	"store":      storeCommand,
+}
+
+var signaturesActions = map[string]func(options *Options) error{
+	"bench": benchSignatures,
+	"print": printSignatures,
+	"test":  testSignatures,
+}
+
+func signaturesCommand(args []string) error {
+	var actions []string
+	for name := range signaturesActions {
+		actions = append(actions, name)
+	}
+	sort.Strings(actions)
+	usage := fmt.Errorf("usage: gitrob signatures {%s} [options]", strings.Join(actions, "|"))
+	if len(args) == 0 {
+		return usage
+	}
+	action, ok := signaturesActions[args[0]]
+	if !ok {
+		return usage
+	}
+	options, err := parseOptions(flag.NewFlagSet("signatures "+args[0], flag.ContinueOnError), args[1:])
+	if err != nil {
+		return err
+	}
+	return action(&options)
+}
+
+// diffCommand compares two session files and writes the new, resolved and
+// persisting findings and the changed repositories and targets.
+func diffCommand(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	format := flags.String("format", "text", "Output format ("+strings.Join(DiffFormats, ", ")+")")
+	identity := flags.String("identity", "", "age identity file to decrypt session files with, instead of a passphrase")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: gitrob diff [-format %s] [-identity file] old-session-file new-session-file",
+			strings.Join(DiffFormats, "|"))
+	}
+	if err := ValidateDiffFormat(*format); err != nil {
+		return err
+	}
+	var older, newer Session
+	if err := older.LoadFromFile(flags.Arg(0), SessionFileOptions{Identity: *identity}); err != nil {
+		return err
+	}
+	if err := newer.LoadFromFile(flags.Arg(1), SessionFileOptions{Identity: *identity}); err != nil {
+		return err
+	}
+	return WriteDiff(os.Stdout, DiffSessions(&older, &newer), *format)
+}
+
+// mergeCommand combines the session files given as arguments and saves the
+// result to the -save file.
+func mergeCommand(args []string) error {
+	return resaveSessionFiles("merge", 2, args)
+}
+
+// exportCommand saves the session file given as argument, or the merge of
+// several, to the -save file, redacted and encrypted as the options say.
+func exportCommand(args []string) error {
+	return resaveSessionFiles("export", 1, args)
+}
+
+func resaveSessionFiles(command string, minFiles int, args []string) error {
+	options, err := parseOptions(flag.NewFlagSet(command, flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if *options.Save == "" || len(options.Logins) < minFiles {
+		return fmt.Errorf("usage: gitrob %s -save session-file [-redact] [-encrypt | -recipient key] [-identity file] "+
+			"session-file...", command)
+	}
+	if common.FileExists(*options.Save) {
+		return fmt.Errorf("file already exists: %s", *options.Save)
+	}
+	// files are decrypted with -identity or the passphrase, not redacted
+	fileOptions := options.SessionFile()
+	merged, err := LoadSessionFiles(options.Logins, SessionFileOptions{Identity: fileOptions.Identity}, nil)
+	if err != nil {
+		return err
+	}
+	if err := merged.SaveToFile(*options.Save, fileOptions); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d %s to %s: %d targets, %d repositories, %d findings, %d users\n", len(options.Logins),
+		common.Pluralize(len(options.Logins), "session", "sessions"), *options.Save, merged.Stats.Targets,
+		merged.Stats.Repositories, merged.Stats.Findings, merged.Stats.Users)
+	return nil
+}
+
+// reportCommand writes the HTML report of the session file given as
+// argument, or of the merge of several, to the -report file, and its GitLab
+// secret detection report to the -gitlab-report file.
+func reportCommand(args []string) error {
+	options, err := parseOptions(flag.NewFlagSet("report", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if (*options.Report == "" && *options.GitLabReport == "") || len(options.Logins) == 0 {
+		return fmt.Errorf("usage: gitrob report {-report file | -gitlab-report file} [-min-severity level] " +
+			"[-min-confidence level] [-identity file] session-file...")
+	}
+	session, err := LoadSessionFiles(options.Logins, SessionFileOptions{Identity: *options.Identity}, nil)
+	if err != nil {
+		return err
+	}
+	session.Options = options
+	if *options.Report != "" {
+		if err := session.SaveReport(*options.Report); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote report of %s to %s\n", strings.Join(options.Logins, ", "), *options.Report)
+	}
+	if *options.GitLabReport != "" {
+		if err := session.SaveGitLabReport(*options.GitLabReport); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote GitLab secret detection report of %s to %s\n", strings.Join(options.Logins, ", "),
+			*options.GitLabReport)
+	}
+	return nil
+}
+
+// recordsCommand writes the findings, repositories, targets or users of the
+// session files given as arguments to standard output as CSV or JSON Lines.
+func recordsCommand(args []string) error {
+	flags := flag.NewFlagSet("records", flag.ContinueOnError)
+	format := flags.String("format", RecordFormatJSONL, "Output format ("+strings.Join(RecordFormats, ", ")+")")
+	identity := flags.String("identity", "", "age identity file to decrypt session files with, instead of a passphrase")
+	minConfidence := flags.String("min-confidence", "", "Only write findings with at least this confidence (high, medium, low)")
+	minSeverity := flags.String("min-severity", "", "Only write findings with at least this severity (critical to info)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 2 {
+		return fmt.Errorf("usage: gitrob records [-format %s] [-min-severity level] [-min-confidence level] "+
+			"[-identity file] {%s} session-file...", strings.Join(RecordFormats, "|"), strings.Join(RecordTypes, "|"))
+	}
+	if err := ValidateRecordFormat(*format); err != nil {
+		return err
+	}
+	if err := ValidateRecordType(flags.Arg(0)); err != nil {
+		return err
+	}
+	if *minSeverity != "" {
+		if err := matching.ValidateSeverity(*minSeverity); err != nil {
+			return err
+		}
+	}
+	if *minConfidence != "" {
+		if err := matching.ValidateConfidence(*minConfidence); err != nil {
+			return err
+		}
+	}
+	session, err := LoadSessionFiles(flags.Args()[1:], SessionFileOptions{Identity: *identity}, nil)
+	if err != nil {
+		return err
+	}
+	session.Options = Options{MinConfidence: minConfidence, MinSeverity: minSeverity}
+	table, err := session.recordTable(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return table.Write(os.Stdout, *format)
+}
+
+// migrateCommand upgrades the session files given as arguments to the current
+// schema version in place, keeping the original next to each as .bak.
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: gitrob migrate session-file...")
+	}
+	for _, location := range args {
+		var session Session
+		version, err := readUnencryptedSession(location, &session)
+		if err != nil {
+			return fmt.Errorf("%s: %s", err, location)
+		}
+		if version == SessionSchemaVersion {
+			fmt.Printf("%s is up to date (schema version %d)\n", location, version)
+			continue
+		}
+		if err := os.Rename(location, location+".bak"); err != nil {
+			return err
+		}
+		if err := session.SaveToFile(location, SessionFileOptions{}); err != nil {
+			_ = os.Rename(location+".bak", location)
+			return err
+		}
+		fmt.Printf("Upgraded %s from schema version %d to %d, the original is in %s.bak\n", location, version,
+			SessionSchemaVersion, location)
+	}
+	return nil
+}
+
+// readUnencryptedSession reads a session file for migration, which encrypted
+// files aren't, as that would need the passphrase twice.
+func readUnencryptedSession(location string, session *Session) (int, error) {
+	f, err := os.Open(location)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if hasPrefix(r, ageHeader) {
+		return 0, fmt.Errorf("encrypted session files are upgraded when loaded, and re-saved with gitrob export")
+	}
+	return session.Read(r, SessionFileOptions{})
+}
+
+var storeActions = map[string]func(options *Options, store *Store) error{
+	"export": exportRun,
+	"import": importRun,
+	"runs":   listRuns,
+}
+
+func storeCommand(args []string) error {
+	var actions []string
+	for name := range storeActions {
+		actions = append(actions, name)
+	}
+	sort.Strings(actions)
+	usage := fmt.Errorf("usage: gitrob store {%s} -store file [-run id] [session file]", strings.Join(actions, "|"))
+	if len(args) == 0 {
+		return usage
+	}
+	action, ok := storeActions[args[0]]
+	if !ok {
+		return usage
+	}
+	options, err := parseOptions(flag.NewFlagSet("store "+args[0], flag.ContinueOnError), args[1:])
+	if err != nil {
+		return err
+	}
+	if *options.Store == "" {
+		return usage
+	}
+	store, err := OpenStore(*options.Store)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return action(&options, store)
+}
+
+func listRuns(_ *Options, store *Store) error {
+	runs, err := store.Runs()
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if run.Stats == nil {
+			run.Stats = &Stats{}
+		}
+		fmt.Printf("%-5d %-10s %-25s %d findings, %d repositories, v%s\n", run.ID, run.Stats.Status,
+			run.Stats.StartedAt.Format(time.RFC3339), run.Stats.Findings, run.Stats.Repositories, run.Version)
+	}
+	return nil
+}
+
+// importRun stores each session file given as argument as a new run.
+func importRun(options *Options, store *Store) error {
+	if len(options.Logins) == 0 {
+		return fmt.Errorf("usage: gitrob store import -store file session-file...")
+	}
+	for _, path := range options.Logins {
+		session, err := LoadSessionFiles([]string{path}, options.SessionFile(), store)
+		if err != nil {
+			return err
+		}
+		if err := store.PutSession(session.RunID, session); err != nil {
+			return err
+		}
+		fmt.Printf("Imported %s as run %d\n", path, session.RunID)
+	}
+	return nil
+}
+
+// exportRun writes the run given with -run, or the latest run, as a session
+// file that can be loaded with -load.
+func exportRun(options *Options, store *Store) error {
+	if len(options.Logins) != 1 {
+		return fmt.Errorf("usage: gitrob store export -store file [-run id] session-file")
+	}
+	if common.FileExists(options.Logins[0]) {
+		return fmt.Errorf("file already exists: %s", options.Logins[0])
+	}
+	run := uint64(*options.Run)
+	if run == 0 {
+		var err error
+		if run, err = store.LatestRun(); err != nil {
+			return err
+		}
+		if run == 0 {
+			return fmt.Errorf("%s holds no runs", *options.Store)
+		}
+	}
+	session := Session{Store: store, RunID: run}
+	if err := store.LoadSession(run, &session); err != nil {
+		return err
+	}
+	var err error
+	if session.Triage, err = store.RunTriage(run); err != nil {
+		return err
+	}
+	if err := session.SaveToFile(options.Logins[0], options.SessionFile()); err != nil {
+		return err
+	}
+	fmt.Printf("Exported run %d to %s\n", run, options.Logins[0])
+	return nil
+}
+
+// printSignatures writes the signatures that a scan with the same options
+// would use, after merging signature files and applying overrides.
+func printSignatures(options *Options) error {
+	signatures, _, err := LoadSignatures(options)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(signatures, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+	return err
+}
+
+// testSignatures checks the examples, counterexamples and patterns of all
+// signatures regardless of -mode and fails when any check fails.
+func testSignatures(options *Options) error {
+	mode := matching.ModeMixed
+	options.Mode = &mode
+	signatures, _, err := LoadSignatures(options)
+	if err != nil {
+		return err
+	}
+	var failed, examples, untested int
+	for _, result := range signatures.Test() {
+		examples += result.Examples
+		if result.Examples == 0 {
+			untested++
+		}
+		if len(result.Failures) == 0 {
+			continue
+		}
+		failed++
+		for _, failure := range result.Failures {
+			fmt.Printf("FAIL %s: %s\n", result.ID, failure)
+		}
+	}
+	total := len(signatures.FileSignatures) + len(signatures.ContentSignatures) + len(signatures.KeyValueSignatures) +
+		len(signatures.CompositeSignatures)
+	fmt.Printf("%d signatures, %d examples, %d failed, %d without examples\n", total, examples, failed, untested)
+	if failed > 0 {
+		return fmt.Errorf("%d %s failed", failed, common.Pluralize(failed, "signature", "signatures"))
+	}
+	return nil
+}
+
+// benchSignatures measures the throughput of the content signatures with and
+// without the keyword prefilter over every text blob in the history of the
+// local repositories given as arguments, or of the current directory.
+func benchSignatures(options *Options) error {
+	mode := matching.ModeContentMatch
+	options.Mode = &mode
+	signatures, _, err := LoadSignatures(options)
+	if err != nil {
+		return err
+	}
+	paths := options.Logins
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	// both variants run on each blob as it is read, so the corpus is never
+	// held in memory
+	var results [2]benchResult
+	var blobs int
+	var size int64
+	for _, path := range paths {
+		err := eachTextBlob(path, func(content string) error {
+			blobs++
+			size += int64(len(content))
+			for i, prefilter := range []bool{false, true} {
+				if err := results[i].run(&signatures, content, prefilter); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	if size == 0 {
+		return fmt.Errorf("no text blobs found in %s", strings.Join(paths, ", "))
+	}
+	fmt.Printf("%d blobs, %.1f MB, %d content signatures\n", blobs, float64(size)/1e6, len(signatures.ContentSignatures))
+	for i, name := range []string{"without prefilter", "with prefilter"} {
+		result := results[i]
+		fmt.Printf("%-18s %8.2f MB/s  %10s  %d regex runs, %d matches\n", name+":",
+			float64(size)/1e6/result.elapsed.Seconds(), result.elapsed.Round(time.Millisecond), result.runs, result.matches)
+	}
+	return nil
+}
+
+type benchResult struct {
+	elapsed       time.Duration
+	runs, matches int
+}
+
+// run matches the content signatures against the content, only running those
+// with a keyword in it when prefilter is set.
+func (r *benchResult) run(signatures *matching.Signatures, content string, prefilter bool) error {
+	start := time.Now()
+	defer func() {
+		r.elapsed += time.Since(start)
+	}()
+	var candidates []bool
+	if prefilter {
+		candidates = signatures.ContentCandidates(content)
+	}
+	for i, sig := range signatures.ContentSignatures {
+		if candidates != nil && !candidates[i] {
+			continue
+		}
+		r.runs++
+		_, ok, err := sig.Find(matching.MatchTarget{Content: content})
+		if err != nil {
+			return fmt.Errorf("%s: %s", sig.ID, err)
+		}
+		if ok {
+			r.matches++
+		}
+	}
+	return nil
+}
+
+// eachTextBlob calls fn with the content of every blob in the repository at
+// path that isn't binary.
+func eachTextBlob(path string, fn func(content string) error) error {
+	repository, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+	blobs, err := repository.BlobObjects()
+	if err != nil {
+		return err
+	}
+	return blobs.ForEach(func(blob *object.Blob) error {
+		reader, err := blob.Reader()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if common.IsBinary(data) {
+			return nil
+		}
+		return fn(string(data))
+	})
+}
@@ -0,0 +1,295 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+// DiffFormats are the formats WriteDiff supports.
+var DiffFormats = []string{"text", "json", "html"}
+
+// SessionDiff compares the findings, repositories and targets of two sessions.
+// Findings are matched by fingerprint and each fingerprint is reported once,
+// by its first finding, so a secret present in many commits counts as one.
+type SessionDiff struct {
+	NewFindings         []*matching.Finding
+	ResolvedFindings    []*matching.Finding
+	PersistingFindings  []*matching.Finding
+	NewRepositories     []*common.Repository
+	RemovedRepositories []*common.Repository
+	NewTargets          []*common.Owner
+	RemovedTargets      []*common.Owner
+}
+
+// DiffSessions compares the sessions of an older and a newer scan. Findings
+// carry the triage of the newer session, or of the older one for resolved
+// findings.
+func DiffSessions(older, newer *Session) *SessionDiff {
+	diff := &SessionDiff{
+		NewFindings:         make([]*matching.Finding, 0),
+		ResolvedFindings:    make([]*matching.Finding, 0),
+		PersistingFindings:  make([]*matching.Finding, 0),
+		NewRepositories:     make([]*common.Repository, 0),
+		RemovedRepositories: make([]*common.Repository, 0),
+		NewTargets:          make([]*common.Owner, 0),
+		RemovedTargets:      make([]*common.Owner, 0),
+	}
+	oldFindings, newFindings := findingsByFingerprint(older), findingsByFingerprint(newer)
+	for _, finding := range uniqueFindings(newer) {
+		if _, ok := oldFindings[finding.Fingerprint]; ok {
+			diff.PersistingFindings = append(diff.PersistingFindings, finding)
+		} else {
+			diff.NewFindings = append(diff.NewFindings, finding)
+		}
+	}
+	for _, finding := range uniqueFindings(older) {
+		if _, ok := newFindings[finding.Fingerprint]; !ok {
+			diff.ResolvedFindings = append(diff.ResolvedFindings, finding)
+		}
+	}
+	for _, findings := range [][]*matching.Finding{diff.NewFindings, diff.ResolvedFindings, diff.PersistingFindings} {
+		matching.SortFindings(findings)
+	}
+
+	oldRepositories, newRepositories := make(map[string]bool), make(map[string]bool)
+	for _, repository := range older.Repositories {
+		oldRepositories[repositoryKey(repository)] = true
+	}
+	for _, repository := range newer.Repositories {
+		newRepositories[repositoryKey(repository)] = true
+		if !oldRepositories[repositoryKey(repository)] {
+			diff.NewRepositories = append(diff.NewRepositories, repository)
+		}
+	}
+	for _, repository := range older.Repositories {
+		if !newRepositories[repositoryKey(repository)] {
+			diff.RemovedRepositories = append(diff.RemovedRepositories, repository)
+		}
+	}
+
+	oldTargets, newTargets := make(map[string]bool), make(map[string]bool)
+	for _, target := range older.Targets {
+		oldTargets[targetKey(target)] = true
+	}
+	for _, target := range newer.Targets {
+		newTargets[targetKey(target)] = true
+		if !oldTargets[targetKey(target)] {
+			diff.NewTargets = append(diff.NewTargets, target)
+		}
+	}
+	for _, target := range older.Targets {
+		if !newTargets[targetKey(target)] {
+			diff.RemovedTargets = append(diff.RemovedTargets, target)
+		}
+	}
+	return diff
+}
+
+func findingsByFingerprint(s *Session) map[string]*matching.Finding {
+	findings := make(map[string]*matching.Finding)
+	for _, finding := range s.Findings {
+		if _, ok := findings[finding.Fingerprint]; !ok {
+			findings[finding.Fingerprint] = finding
+		}
+	}
+	return findings
+}
+
+// uniqueFindings returns the first finding of every fingerprint in the order
+// of the session, with its triage.
+func uniqueFindings(s *Session) []*matching.Finding {
+	seen := make(map[string]bool)
+	var findings []*matching.Finding
+	for _, finding := range s.Findings {
+		if seen[finding.Fingerprint] {
+			continue
+		}
+		seen[finding.Fingerprint] = true
+		if triage, ok := s.Triage[finding.Fingerprint]; ok {
+			finding.Triage = triage
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// repositoryKey identifies repositories by provider and ID, since IDs of
+// GitHub and GitLab repositories can collide. Repositories without either
+// fall back to their clone URL.
+func repositoryKey(repository *common.Repository) string {
+	if repository.Provider != nil && repository.ID != nil {
+		return fmt.Sprintf("%s:%d", *repository.Provider, *repository.ID)
+	}
+	return stringValue(repository.CloneURL)
+}
+
+// targetKey identifies targets by provider and ID, since IDs of GitHub users
+// and organizations and GitLab groups can collide, and so can their logins.
+// Targets without either fall back to their login.
+func targetKey(target *common.Owner) string {
+	if target.Provider != nil && target.ID != nil {
+		return fmt.Sprintf("%s:%d", *target.Provider, *target.ID)
+	}
+	return stringValue(target.Login)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func ValidateDiffFormat(format string) error {
+	for _, f := range DiffFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported diff format %q, expected one of %s", format, strings.Join(DiffFormats, ", "))
+}
+
+// WriteDiff writes the diff as text, JSON or a standalone HTML page.
+func WriteDiff(w io.Writer, diff *SessionDiff, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	case "html":
+		return diffTemplate.Execute(w, diff)
+	case "text":
+		return writeTextDiff(w, diff)
+	}
+	return ValidateDiffFormat(format)
+}
+
+func writeTextDiff(w io.Writer, diff *SessionDiff) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Findings....: %d new, %d resolved, %d persisting\n", len(diff.NewFindings),
+		len(diff.ResolvedFindings), len(diff.PersistingFindings))
+	fmt.Fprintf(&b, "Repositories: %d new, %d removed\n", len(diff.NewRepositories), len(diff.RemovedRepositories))
+	fmt.Fprintf(&b, "Targets.....: %d new, %d removed\n", len(diff.NewTargets), len(diff.RemovedTargets))
+	for _, section := range []struct {
+		title    string
+		findings []*matching.Finding
+	}{
+		{"New findings", diff.NewFindings},
+		{"Resolved findings", diff.ResolvedFindings},
+		{"Persisting findings", diff.PersistingFindings},
+	} {
+		if len(section.findings) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", section.title)
+		for _, finding := range section.findings {
+			fmt.Fprintf(&b, "  %-8s %s/%s %s: %s", finding.Severity, finding.RepositoryOwner, finding.RepositoryName,
+				finding.FilePath, diffDescription(finding))
+			if finding.Triage != nil {
+				fmt.Fprintf(&b, " [%s]", finding.Triage.Status)
+			}
+			b.WriteString("\n")
+		}
+	}
+	for _, section := range []struct {
+		title        string
+		repositories []*common.Repository
+	}{
+		{"New repositories", diff.NewRepositories},
+		{"Removed repositories", diff.RemovedRepositories},
+	} {
+		if len(section.repositories) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", section.title)
+		for _, repository := range section.repositories {
+			fmt.Fprintf(&b, "  %s\n", stringValue(repository.FullName))
+		}
+	}
+	for _, section := range []struct {
+		title   string
+		targets []*common.Owner
+	}{
+		{"New targets", diff.NewTargets},
+		{"Removed targets", diff.RemovedTargets},
+	} {
+		if len(section.targets) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", section.title)
+		for _, target := range section.targets {
+			fmt.Fprintf(&b, "  %s\n", stringValue(target.Login))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// diffDescription is the content signature description of the finding, or
+// its file signature description for file matches.
+func diffDescription(finding *matching.Finding) string {
+	if finding.ContentSignatureDescription != "" && finding.ContentSignatureDescription != "NA" {
+		return finding.ContentSignatureDescription
+	}
+	return finding.FileSignatureDescription
+}
+
+var diffTemplate = template.Must(template.New("diff").Funcs(template.FuncMap{
+	"description": diffDescription,
+	"value":       stringValue,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <style type="text/css">
+        body { background: #202020; color: #dddddd; font-family: sans-serif; }
+        a { color: #8ab4f8; }
+        td, th { border: 1px solid #666666; padding: 6px 10px; text-align: left; }
+        table { border-collapse: collapse; margin-bottom: 20px; }
+    </style>
+    <title>Gitrob session diff</title>
+</head>
+<body>
+<h1>Session diff</h1>
+<table>
+    <tr><th>Findings</th><td>{{len .NewFindings}} new, {{len .ResolvedFindings}} resolved, {{len .PersistingFindings}} persisting</td></tr>
+    <tr><th>Repositories</th><td>{{len .NewRepositories}} new, {{len .RemovedRepositories}} removed</td></tr>
+    <tr><th>Targets</th><td>{{len .NewTargets}} new, {{len .RemovedTargets}} removed</td></tr>
+</table>
+{{define "findings"}}
+<table>
+    <thead><tr><th>Severity</th><th>Repository</th><th>Path</th><th>Match</th><th>Commit</th><th>Triage</th></tr></thead>
+    <tbody>
+    {{range .}}
+    <tr>
+        <td>{{.Severity}} ({{.Confidence}})</td>
+        <td><a href="{{.RepositoryURL}}">{{.RepositoryOwner}}/{{.RepositoryName}}</a></td>
+        <td><a href="{{.FileURL}}">{{.FilePath}}</a></td>
+        <td>{{description .}}</td>
+        <td><a href="{{.CommitURL}}">{{printf "%.7s" .CommitHash}}</a></td>
+        <td>{{if .Triage}}{{.Triage.Status}}{{end}}</td>
+    </tr>
+    {{end}}
+    </tbody>
+</table>
+{{end}}
+{{if .NewFindings}}<h2>New findings</h2>{{template "findings" .NewFindings}}{{end}}
+{{if .ResolvedFindings}}<h2>Resolved findings</h2>{{template "findings" .ResolvedFindings}}{{end}}
+{{if .PersistingFindings}}<h2>Persisting findings</h2>{{template "findings" .PersistingFindings}}{{end}}
+{{if .NewRepositories}}<h2>New repositories</h2>
+<ul>{{range .NewRepositories}}<li>{{value .FullName}}</li>{{end}}</ul>{{end}}
+{{if .RemovedRepositories}}<h2>Removed repositories</h2>
+<ul>{{range .RemovedRepositories}}<li>{{value .FullName}}</li>{{end}}</ul>{{end}}
+{{if .NewTargets}}<h2>New targets</h2>
+<ul>{{range .NewTargets}}<li>{{value .Login}}</li>{{end}}</ul>{{end}}
+{{if .RemovedTargets}}<h2>Removed targets</h2>
+<ul>{{range .RemovedTargets}}<li>{{value .Login}}</li>{{end}}</ul>{{end}}
+</body>
+</html>
+`))
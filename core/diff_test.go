@@ -0,0 +1,58 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+func TestDiffSessions(t *testing.T) {
+	older := &Session{
+		Targets:      []*common.Owner{testOwner(common.ProviderGitHub, 1, "acme"), testOwner(common.ProviderGitHub, 2, "retired")},
+		Repositories: []*common.Repository{testRepository(1, "https://github.com/acme/api.git"), testRepository(2, "https://github.com/acme/old.git")},
+		Findings: []*matching.Finding{
+			{Fingerprint: "persisting", Severity: matching.SeverityHigh},
+			{Fingerprint: "resolved", Severity: matching.SeverityLow},
+		},
+		Triage: map[string]*matching.Triage{"resolved": {Status: matching.TriageRevoked}},
+	}
+	newer := &Session{
+		Targets:      []*common.Owner{testOwner(common.ProviderGitHub, 1, "acme-inc"), testOwner(common.ProviderGitHub, 4, "acme-labs")},
+		Repositories: []*common.Repository{testRepository(1, "https://github.com/acme/api-v2.git"), testRepository(1, "https://gitlab.com/acme/api.git")},
+		Findings: []*matching.Finding{
+			{Fingerprint: "new", Severity: matching.SeverityLow},
+			{Fingerprint: "persisting", Severity: matching.SeverityHigh},
+			{Fingerprint: "new", Severity: matching.SeverityLow},
+		},
+		Triage: map[string]*matching.Triage{"persisting": {Status: matching.TriageAcceptedRisk}},
+	}
+	diff := DiffSessions(older, newer)
+
+	tests := []struct {
+		name      string
+		got, want []string
+	}{
+		{"new findings", fingerprints(diff.NewFindings), []string{"new"}},
+		{"resolved findings", fingerprints(diff.ResolvedFindings), []string{"resolved"}},
+		{"persisting findings", fingerprints(diff.PersistingFindings), []string{"persisting"}},
+		{"new repositories", repositoryKeys(diff.NewRepositories), []string{"gitlab:1"}},
+		{"removed repositories", repositoryKeys(diff.RemovedRepositories), []string{"github:2"}},
+		{"new targets", targetKeys(diff.NewTargets), []string{"github:4"}},
+		{"removed targets", targetKeys(diff.RemovedTargets), []string{"github:2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.got, test.want) {
+				t.Errorf("got %q, want %q", test.got, test.want)
+			}
+		})
+	}
+	if triage := diff.PersistingFindings[0].Triage; triage == nil || triage.Status != matching.TriageAcceptedRisk {
+		t.Errorf("triage of the persisting finding = %v, want the newer triage", triage)
+	}
+	if triage := diff.ResolvedFindings[0].Triage; triage == nil || triage.Status != matching.TriageRevoked {
+		t.Errorf("triage of the resolved finding = %v, want the older triage", triage)
+	}
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeOwnerOnly writes a file with write, readable by the owner only. The
+// file is written to a temporary file next to location that replaces it once
+// complete, so an existing file is never truncated or readable by others,
+// and a failed write leaves it as it was.
+func writeOwnerOnly(location string, write func(io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(location), filepath.Base(location)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	// TempFile creates files readable by the owner only
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), location)
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteOwnerOnly(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.html")
+	if err := os.WriteFile(existing, []byte("old content that is longer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kept := filepath.Join(dir, "kept.html")
+	if err := os.WriteFile(kept, []byte("old content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		location string
+		err      error
+		want     string
+		wantMode os.FileMode
+	}{
+		{"new file", filepath.Join(dir, "new.html"), nil, "report", 0600},
+		{"existing file", existing, nil, "report", 0600},
+		{"failed write", filepath.Join(dir, "failed.html"), errors.New("write failed"), "", 0},
+		{"failed write over an existing file", kept, errors.New("write failed"), "old content", 0644},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := writeOwnerOnly(test.location, func(w io.Writer) error {
+				if _, err := io.WriteString(w, "report"); err != nil {
+					return err
+				}
+				return test.err
+			})
+			if err != test.err {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+			info, err := os.Stat(test.location)
+			if test.want == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("failed write left %s behind", test.location)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := info.Mode().Perm(); mode != test.wantMode {
+				t.Errorf("mode = %o, want %o", mode, test.wantMode)
+			}
+			if data, _ := os.ReadFile(test.location); string(data) != test.want {
+				t.Errorf("content = %q, want %q", data, test.want)
+			}
+		})
+	}
+	if temporary, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(temporary) != 0 {
+		t.Errorf("temporary files left behind: %v", temporary)
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FingerprintKeyEnvVariable holds the key that personal data is fingerprinted
+// with. Teams that share triage set the same key on every machine.
+const FingerprintKeyEnvVariable = "GITROB_FINGERPRINT_KEY" //nolint:gosec
+
+// fingerprintKeyFile is the location of the key generated for the user when
+// GITROB_FINGERPRINT_KEY isn't set.
+func fingerprintKeyFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gitrob", "fingerprint-key"), nil
+}
+
+// loadFingerprintKey returns the key from GITROB_FINGERPRINT_KEY, or else the
+// key in the key file of the user, which is created with a random key the
+// first time.
+func loadFingerprintKey() ([]byte, error) {
+	if key := os.Getenv(FingerprintKeyEnvVariable); key != "" {
+		return []byte(key), nil
+	}
+	location, err := fingerprintKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(location)
+	if err == nil && strings.TrimSpace(string(data)) != "" {
+		return []byte(strings.TrimSpace(string(data))), nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	key := hex.EncodeToString(random)
+	if err := os.MkdirAll(filepath.Dir(location), 0700); err != nil {
+		return nil, err
+	}
+	err = writeOwnerOnly(location, func(w io.Writer) error {
+		_, err := io.WriteString(w, key+"\n")
+		return err
+	})
+	return []byte(key), err
+}
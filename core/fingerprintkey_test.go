@@ -0,0 +1,44 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFingerprintKey(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv(FingerprintKeyEnvVariable, "")
+
+	generated, err := loadFingerprintKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generated) != 64 {
+		t.Errorf("generated key %q, want 32 random bytes in hex", generated)
+	}
+	info, err := os.Stat(filepath.Join(dir, "gitrob", "fingerprint-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("key file mode = %o, want 600", mode)
+	}
+	again, err := loadFingerprintKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(generated) {
+		t.Errorf("second load returned %q, want the generated key %q", again, generated)
+	}
+
+	t.Setenv(FingerprintKeyEnvVariable, "shared team key")
+	shared, err := loadFingerprintKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(shared) != "shared team key" {
+		t.Errorf("key = %q, want the key of %s", shared, FingerprintKeyEnvVariable)
+	}
+}
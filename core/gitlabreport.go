@@ -0,0 +1,207 @@
+package core
+
+import (
+	"crypto/sha1" //nolint:gosec
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+const (
+	// GitLabReportSchemaVersion is the version of GitLab's security report
+	// schema that GitLab reports are written in.
+	GitLabReportSchemaVersion = "15.0.6"
+	gitLabReportTimeFormat    = "2006-01-02T15:04:05"
+	gitLabIdentifierType      = "gitrob_signature_id"
+)
+
+// GitLabReport is a GitLab secret detection report, as read from the
+// gl-secret-detection-report.json artifact of a CI job.
+type GitLabReport struct {
+	Version         string                `json:"version"`
+	Scan            GitLabScan            `json:"scan"`
+	Vulnerabilities []GitLabVulnerability `json:"vulnerabilities"`
+}
+
+type GitLabScan struct {
+	Analyzer  GitLabScanner `json:"analyzer"`
+	Scanner   GitLabScanner `json:"scanner"`
+	Type      string        `json:"type"`
+	StartTime string        `json:"start_time"`
+	EndTime   string        `json:"end_time"`
+	Status    string        `json:"status"`
+}
+
+type GitLabScanner struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Version string       `json:"version"`
+	Vendor  GitLabVendor `json:"vendor"`
+}
+
+type GitLabVendor struct {
+	Name string `json:"name"`
+}
+
+type GitLabVulnerability struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Severity    string             `json:"severity"`
+	Location    GitLabLocation     `json:"location"`
+	Identifiers []GitLabIdentifier `json:"identifiers"`
+}
+
+type GitLabLocation struct {
+	File      string       `json:"file"`
+	StartLine int          `json:"start_line,omitempty"`
+	EndLine   int          `json:"end_line,omitempty"`
+	Commit    GitLabCommit `json:"commit"`
+}
+
+type GitLabCommit struct {
+	SHA     string `json:"sha"`
+	Author  string `json:"author,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type GitLabIdentifier struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+var gitLabSeverities = map[string]string{
+	matching.SeverityCritical: "Critical",
+	matching.SeverityHigh:     "High",
+	matching.SeverityMedium:   "Medium",
+	matching.SeverityLow:      "Low",
+	matching.SeverityInfo:     "Info",
+}
+
+// NewGitLabReport maps the findings of the session, filtered by the
+// thresholds of its options, to GitLab vulnerabilities. Findings triaged as
+// false positives are left out.
+func NewGitLabReport(s *Session) (*GitLabReport, error) {
+	findings, err := s.QueryFindings(func(finding *matching.Finding) bool {
+		return finding.TriageStatus() != matching.TriageFalsePositive
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := s.Stats
+	if stats == nil {
+		stats = &Stats{}
+	}
+	scanner := GitLabScanner{
+		ID:      common.Name,
+		Name:    "Gitrob",
+		Version: common.Version,
+		Vendor:  GitLabVendor{Name: "Gitrob"},
+	}
+	status := "success"
+	if stats.Status != StatusFinished {
+		status = "failure"
+	}
+	report := &GitLabReport{
+		Version: GitLabReportSchemaVersion,
+		Scan: GitLabScan{
+			Analyzer:  scanner,
+			Scanner:   scanner,
+			Type:      "secret_detection",
+			StartTime: stats.StartedAt.UTC().Format(gitLabReportTimeFormat),
+			EndTime:   stats.FinishedAt.UTC().Format(gitLabReportTimeFormat),
+			Status:    status,
+		},
+		Vulnerabilities: make([]GitLabVulnerability, 0, len(findings)),
+	}
+	if stats.FinishedAt.IsZero() {
+		report.Scan.EndTime = time.Now().UTC().Format(gitLabReportTimeFormat)
+	}
+	for _, finding := range findings {
+		report.Vulnerabilities = append(report.Vulnerabilities, gitLabVulnerability(finding))
+	}
+	return report, nil
+}
+
+func gitLabVulnerability(finding *matching.Finding) GitLabVulnerability {
+	description := diffDescription(finding)
+	severity, ok := gitLabSeverities[finding.Severity]
+	if !ok {
+		severity = "Unknown"
+	}
+	return GitLabVulnerability{
+		ID:          gitLabVulnerabilityID(finding),
+		Name:        description,
+		Description: gitLabDescription(finding),
+		Severity:    severity,
+		Location: GitLabLocation{
+			File:      finding.FilePath,
+			StartLine: finding.Line,
+			EndLine:   finding.Line,
+			Commit: GitLabCommit{
+				SHA:     finding.CommitHash,
+				Author:  finding.CommitAuthor,
+				Message: strings.TrimSpace(finding.CommitMessage),
+			},
+		},
+		Identifiers: []GitLabIdentifier{{
+			Type:  gitLabIdentifierType,
+			Name:  "Gitrob " + description,
+			Value: reportSignatureID(finding),
+		}},
+	}
+}
+
+// gitLabVulnerabilityID derives a UUID from the ID and fingerprint of the
+// finding, so that it is stable across reports.
+func gitLabVulnerabilityID(finding *matching.Finding) string {
+	sum := sha1.Sum([]byte(finding.ID + finding.Fingerprint)) //nolint:gosec
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// gitLabDescription describes the match and the repository it is in, since a
+// session can span several repositories.
+func gitLabDescription(finding *matching.Finding) string {
+	var parts []string
+	for _, comment := range []string{finding.ContentSignatureComment, finding.FileSignatureComment} {
+		if comment != "" {
+			parts = append(parts, comment)
+		}
+	}
+	parts = append(parts, fmt.Sprintf("Found in %s/%s (confidence %s).", finding.RepositoryOwner,
+		finding.RepositoryName, finding.Confidence))
+	if finding.RedactedValue != "" {
+		parts = append(parts, "Value: "+finding.RedactedValue)
+	}
+	if finding.VerificationStatus != "" {
+		parts = append(parts, "Verification: "+finding.VerificationStatus+".")
+	}
+	return strings.Join(parts, " ")
+}
+
+// WriteGitLabReport writes the GitLab secret detection report of the session.
+func WriteGitLabReport(w io.Writer, s *Session) error {
+	report, err := NewGitLabReport(s)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// SaveGitLabReport writes the GitLab secret detection report of the session
+// to location, readable by the owner only.
+func (s *Session) SaveGitLabReport(location string) error {
+	return writeOwnerOnly(location, func(w io.Writer) error {
+		return WriteGitLabReport(w, s)
+	})
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitrob/matching"
+)
+
+func TestNewGitLabReport(t *testing.T) {
+	s := newTestSession(t)
+	s.Stats.FinishedAt = time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	s.Stats.Status = StatusFinished
+	s.Findings = []*matching.Finding{
+		{ID: "f1", Fingerprint: "fp1", Severity: matching.SeverityCritical, Confidence: matching.ConfidenceHigh,
+			FilePath: "config/.env", Line: 12, ContentSignatureID: "aws-secret-key", ContentSignatureDescription: "AWS secret key",
+			RepositoryOwner: "acme", RepositoryName: "api", CommitHash: "abc123", CommitMessage: "Add config\n"},
+		{ID: "f2", Fingerprint: "fp2", Severity: matching.SeverityHigh, FilePath: "deploy/id_rsa",
+			FileSignatureID: "private-ssh-key", FileSignatureDescription: "Private SSH key"},
+		{ID: "f3", Fingerprint: "fp3", Severity: matching.SeverityLow, FilePath: "test/fixtures.json", Line: 4,
+			ContentSignatureID: "generic-secret"},
+		{ID: "f4", Fingerprint: "fp4", Severity: "unrated", FilePath: "notes.txt", Line: 1, ContentSignatureID: "custom"},
+	}
+	s.Triage = map[string]*matching.Triage{"fp3": {Status: matching.TriageFalsePositive}}
+	report, err := NewGitLabReport(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scan.Status != "success" || report.Scan.EndTime != "2024-05-01T09:00:00" {
+		t.Errorf("scan status %s ending %s, want success ending 2024-05-01T09:00:00", report.Scan.Status, report.Scan.EndTime)
+	}
+
+	tests := []struct {
+		name       string
+		severity   string
+		location   GitLabLocation
+		identifier string
+	}{
+		{"content match", "Critical", GitLabLocation{File: "config/.env", StartLine: 12, EndLine: 12,
+			Commit: GitLabCommit{SHA: "abc123", Message: "Add config"}}, "aws-secret-key"},
+		{"file match", "High", GitLabLocation{File: "deploy/id_rsa"}, "private-ssh-key"},
+		{"unknown severity", "Unknown", GitLabLocation{File: "notes.txt", StartLine: 1, EndLine: 1}, "custom"},
+	}
+	if len(report.Vulnerabilities) != len(tests) {
+		t.Fatalf("got %d vulnerabilities, want %d without the false positive", len(report.Vulnerabilities), len(tests))
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vulnerability := report.Vulnerabilities[i]
+			if vulnerability.Severity != test.severity {
+				t.Errorf("severity = %s, want %s", vulnerability.Severity, test.severity)
+			}
+			if !reflect.DeepEqual(vulnerability.Location, test.location) {
+				t.Errorf("location = %+v, want %+v", vulnerability.Location, test.location)
+			}
+			if identifier := vulnerability.Identifiers[0]; identifier.Type != gitLabIdentifierType || identifier.Value != test.identifier {
+				t.Errorf("identifier = %+v, want %s %s", identifier, gitLabIdentifierType, test.identifier)
+			}
+		})
+	}
+	if again := gitLabVulnerabilityID(s.Findings[0]); again != report.Vulnerabilities[0].ID {
+		t.Errorf("vulnerability ID changed from %s to %s", report.Vulnerabilities[0].ID, again)
+	}
+}
+
+func TestSaveGitLabReport(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "gl-secret-detection-report.json")
+	s := newTestSession(t)
+	s.Findings = []*matching.Finding{{ID: "f1", Fingerprint: "fp1", Severity: matching.SeverityHigh, FilePath: ".env",
+		Line: 2, ContentSignatureID: "slack-token"}}
+	if err := s.SaveGitLabReport(location); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report map[string]interface{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	vulnerabilities, _ := report["vulnerabilities"].([]interface{})
+	if report["version"] != GitLabReportSchemaVersion || len(vulnerabilities) != 1 {
+		t.Fatalf("report version %v with %d vulnerabilities, want %s with 1", report["version"], len(vulnerabilities), GitLabReportSchemaVersion)
+	}
+	found := vulnerabilities[0].(map[string]interface{})["location"].(map[string]interface{})
+	if found["start_line"] != 2.0 || found["end_line"] != 2.0 {
+		t.Errorf("location = %v, want start_line and end_line 2", found)
+	}
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+// MergeSessions combines sessions of scans sharded across machines. Targets
+// are deduplicated by login and repositories by clone URL, as in DiffSessions,
+// findings by ID and fingerprint, since the ID only identifies the change,
+// and users by signature. The more recent triage of a fingerprint wins. The
+// stats are recomputed, summing commits and files, which can't be
+// deduplicated.
+func MergeSessions(sessions []*Session) *Session {
+	merged := &Session{
+		Version:      common.Version,
+		Redacted:     anyRedacted(sessions),
+		Stats:        &Stats{Status: StatusFinished, Progress: ProgressBarCap},
+		Targets:      make([]*common.Owner, 0),
+		Repositories: make([]*common.Repository, 0),
+		Findings:     make([]*matching.Finding, 0),
+		Suppressed:   make([]*matching.Finding, 0),
+		Triage:       make(map[string]*matching.Triage),
+		Users:        make([]UserSignature, 0),
+	}
+	targets, repositories := make(map[string]bool), make(map[string]bool)
+	findings, suppressed, users := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	for _, s := range sessions {
+		for _, target := range s.Targets {
+			if key := targetKey(target); key == "" || !targets[key] {
+				targets[key] = true
+				merged.Targets = append(merged.Targets, target)
+			}
+		}
+		for _, repository := range s.Repositories {
+			if key := repositoryKey(repository); key == "" || !repositories[key] {
+				repositories[key] = true
+				merged.Repositories = append(merged.Repositories, repository)
+			}
+		}
+		for _, finding := range s.Findings {
+			if key := finding.ID + finding.Fingerprint; !findings[key] {
+				findings[key] = true
+				merged.Findings = append(merged.Findings, finding)
+			}
+		}
+		for _, finding := range s.Suppressed {
+			if key := finding.ID + finding.Fingerprint; !suppressed[key] {
+				suppressed[key] = true
+				merged.Suppressed = append(merged.Suppressed, finding)
+			}
+		}
+		for _, user := range s.Users {
+			signature := fmt.Sprintf("%s <%s>", user.Username, user.Email)
+			if !users[signature] {
+				users[signature] = true
+				merged.Users = append(merged.Users, user)
+			}
+		}
+		matching.MergeTriage(merged.Triage, s.Triage)
+		if s.Stats != nil {
+			mergeStats(merged.Stats, s.Stats)
+		}
+	}
+	merged.Stats.Targets = len(merged.Targets)
+	merged.Stats.Repositories = len(merged.Repositories)
+	merged.Stats.Findings = len(merged.Findings)
+	merged.Stats.Suppressed = len(merged.Suppressed)
+	merged.Stats.Users = len(merged.Users)
+	if merged.Stats.Status != StatusFinished {
+		merged.Stats.FinishedAt = time.Time{}
+	}
+	return merged
+}
+
+// mergeStats widens the time range of the merged stats to cover the session
+// and adds its commits and files. The merged session is only finished when
+// every session is.
+func mergeStats(merged, stats *Stats) {
+	if merged.StartedAt.IsZero() || (!stats.StartedAt.IsZero() && stats.StartedAt.Before(merged.StartedAt)) {
+		merged.StartedAt = stats.StartedAt
+	}
+	if stats.FinishedAt.After(merged.FinishedAt) {
+		merged.FinishedAt = stats.FinishedAt
+	}
+	merged.Commits += stats.Commits
+	merged.Files += stats.Files
+	if stats.Status != StatusFinished {
+		merged.Status = stats.Status
+		merged.Progress = stats.Progress
+	}
+}
+
+// LoadSessionFiles loads the session files, merging them when there are
+// several. With a store, their findings are written to a new run of it as
+// they are read rather than held in memory, and the run is returned with the
+// session, whose other fields are left to be stored once it is initialized.
+func LoadSessionFiles(locations []string, options SessionFileOptions, store *Store) (*Session, error) {
+	var writer *findingWriter
+	if store != nil {
+		run, err := store.NewRun()
+		if err != nil {
+			return nil, err
+		}
+		writer = newFindingWriter(store, run)
+	}
+	session, err := loadSessionFiles(locations, options, writer)
+	if err != nil && writer != nil {
+		_ = store.DeleteRun(writer.run)
+	}
+	return session, err
+}
+
+func loadSessionFiles(locations []string, options SessionFileOptions, writer *findingWriter) (*Session, error) {
+	var sessions []*Session
+	for _, location := range locations {
+		s := Session{findingWriter: writer}
+		if err := s.LoadFromFile(location, options); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+	merged := sessions[0]
+	if len(sessions) > 1 {
+		merged = MergeSessions(sessions)
+	}
+	if writer == nil {
+		return merged, nil
+	}
+	if err := writer.flush(); err != nil {
+		return nil, err
+	}
+	merged.Store, merged.RunID, merged.findingWriter = writer.store, writer.run, nil
+	if len(sessions) > 1 {
+		var err error
+		if merged.Stats.Findings, merged.Stats.Suppressed, err = writer.store.CountFindings(writer.run); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+func anyRedacted(sessions []*Session) bool {
+	for _, s := range sessions {
+		if s.Redacted {
+			return true
+		}
+	}
+	return false
+}
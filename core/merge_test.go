@@ -0,0 +1,85 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+func repositoryKeys(repositories []*common.Repository) []string {
+	var keys []string
+	for _, repository := range repositories {
+		keys = append(keys, repositoryKey(repository))
+	}
+	return keys
+}
+
+func targetKeys(targets []*common.Owner) []string {
+	var keys []string
+	for _, target := range targets {
+		keys = append(keys, targetKey(target))
+	}
+	return keys
+}
+
+func TestMergeSessions(t *testing.T) {
+	start, finish := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	older, newer := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	github := &Session{
+		Stats:   &Stats{Status: StatusFinished, StartedAt: start.Add(time.Minute), FinishedAt: finish, Commits: 10, Files: 100},
+		Targets: []*common.Owner{testOwner(common.ProviderGitHub, 7, "acme")},
+		Repositories: []*common.Repository{
+			testRepository(7, "https://github.com/acme/api.git"),
+			testRepository(7, "https://github.com/acme/api-renamed.git"),
+		},
+		Findings: []*matching.Finding{
+			{ID: "1", Fingerprint: "a"},
+			{ID: "2", Fingerprint: "a"},
+		},
+		Triage: map[string]*matching.Triage{"a": {Status: matching.TriageConfirmed, UpdatedAt: older}},
+		Users:  []UserSignature{{Username: "jane", Email: "jane@acme.example"}},
+	}
+	gitlab := &Session{
+		Stats:   &Stats{Status: StatusFinished, StartedAt: start, FinishedAt: finish.Add(-time.Minute), Commits: 5, Files: 50},
+		Targets: []*common.Owner{testOwner(common.ProviderGitLab, 7, "acme-group"), testOwner(common.ProviderGitLab, 8, "acme")},
+		Repositories: []*common.Repository{
+			testRepository(7, "https://gitlab.com/acme-group/api.git"),
+			testRepository(8, "https://gitlab.com/acme/api.git"),
+		},
+		Findings: []*matching.Finding{
+			{ID: "1", Fingerprint: "a"},
+			{ID: "3", Fingerprint: "b"},
+		},
+		Suppressed: []*matching.Finding{{ID: "4", Fingerprint: "c"}},
+		Triage:     map[string]*matching.Triage{"a": {Status: matching.TriageRevoked, UpdatedAt: newer}},
+		Users:      []UserSignature{{Username: "jane", Email: "jane@acme.example"}, {Username: "joe", Email: "joe@acme.example"}},
+	}
+	merged := MergeSessions([]*Session{github, gitlab})
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"targets", targetKeys(merged.Targets), []string{"github:7", "gitlab:7", "gitlab:8"}},
+		{"repositories", repositoryKeys(merged.Repositories), []string{"github:7", "gitlab:7", "gitlab:8"}},
+		{"findings", len(merged.Findings), 3},
+		{"suppressed findings", len(merged.Suppressed), 1},
+		{"users", len(merged.Users), 2},
+		{"triage", merged.Triage["a"].Status, matching.TriageRevoked},
+		{"started at", merged.Stats.StartedAt, start},
+		{"finished at", merged.Stats.FinishedAt, finish},
+		{"commits", merged.Stats.Commits, 15},
+		{"files", merged.Stats.Files, 150},
+		{"stats", []int{merged.Stats.Targets, merged.Stats.Repositories, merged.Stats.Findings}, []int{3, 3, 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.got, test.want) {
+				t.Errorf("got %v, want %v", test.got, test.want)
+			}
+		})
+	}
+}
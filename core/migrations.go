@@ -0,0 +1,238 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+// SessionSchemaVersion is the version of the session file format written by
+// SaveToFile. Files without a SchemaVersion have version 0.
+const SessionSchemaVersion = 1
+
+// sessionDocument is a decoded session file. Numbers are kept as json.Number
+// so that 64-bit IDs survive a migration.
+type sessionDocument map[string]interface{}
+
+// sessionMigration upgrades a session file from one version to the next.
+// Findings are upgraded one at a time as they are read, so that a file is
+// never decoded whole. Targets, repositories and users are decoded into the
+// session as they are; a change to their format needs a migration of its own.
+type sessionMigration struct {
+	// Document upgrades everything but the arrays.
+	Document func(doc sessionDocument) error
+	// Finding upgrades a finding or suppressed finding.
+	Finding func(finding map[string]interface{}) error
+}
+
+// sessionMigrations upgrade session files one version at a time: the
+// migration at index i upgrades a file from version i to version i+1. A
+// change to the format that older files can't be read with adds a migration
+// and increments SessionSchemaVersion.
+var sessionMigrations = []sessionMigration{
+	{Document: migrateSessionToV1, Finding: migrateFindingToV1},
+}
+
+var errCorruptSession = fmt.Errorf("session file is corrupt")
+
+// decodeSession reads a session file from r, upgrading it to
+// SessionSchemaVersion, and returns the version it had. Targets,
+// repositories and users are decoded straight into the session, and findings
+// one at a time and passed to loadFinding, so the file is never decoded
+// whole.
+func decodeSession(r io.Reader, s *Session) (int, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return 0, errCorruptSession
+	}
+	doc := make(sessionDocument)
+	version, versionRead := 0, false
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return version, errCorruptSession
+		}
+		key, _ := token.(string)
+		var list interface{}
+		switch key {
+		case "Targets":
+			list = &s.Targets
+		case "Repositories":
+			list = &s.Repositories
+		case "Users":
+			list = &s.Users
+		case "Findings", "Suppressed":
+		default:
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				return version, errCorruptSession
+			}
+			if key == "SchemaVersion" && !versionRead {
+				number, ok := value.(json.Number)
+				n, err := number.Int64()
+				if !ok || err != nil || n < 0 {
+					return 0, fmt.Errorf("session file has an invalid SchemaVersion")
+				}
+				version, versionRead = int(n), true
+			}
+			doc[key] = value
+			continue
+		}
+		if version > SessionSchemaVersion {
+			return version, newerSessionError(version, doc)
+		}
+		// the schema version is written first, so later ones are ignored
+		versionRead = true
+		if list != nil {
+			if err := decoder.Decode(list); err != nil {
+				return version, fmt.Errorf("session file is corrupt: %s", err)
+			}
+			continue
+		}
+		suppressed := key == "Suppressed"
+		err = decodeFindings(decoder, version, func(finding *matching.Finding) error {
+			return s.loadFinding(finding, suppressed)
+		})
+		if err != nil {
+			return version, err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return version, errCorruptSession
+	}
+	if version > SessionSchemaVersion {
+		return version, newerSessionError(version, doc)
+	}
+	for i := version; i < SessionSchemaVersion; i++ {
+		if err := sessionMigrations[i].Document(doc); err != nil {
+			return version, fmt.Errorf("upgrading session file from schema version %d: %s", i, err)
+		}
+	}
+	doc["SchemaVersion"] = SessionSchemaVersion
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return version, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return version, fmt.Errorf("session file is corrupt: %s", err)
+	}
+	fillProviders(s)
+	return version, nil
+}
+
+// fillProviders sets the provider of the targets and repositories of session
+// files and stored runs written before it was recorded. A repository's provider is the host
+// of its clone URL. Since a session scans a single provider, targets get the
+// provider of the repositories, or else the host of their URL.
+func fillProviders(s *Session) {
+	provider := ""
+	for _, repository := range s.Repositories {
+		if repository.Provider == nil {
+			if p := common.ProviderFromURL(stringValue(repository.CloneURL)); p != "" {
+				repository.Provider = &p
+			}
+		}
+		if repository.Provider != nil {
+			provider = *repository.Provider
+		}
+	}
+	for _, target := range s.Targets {
+		if target.Provider != nil {
+			continue
+		}
+		p := provider
+		if p == "" {
+			p = common.ProviderFromURL(stringValue(target.URL))
+		}
+		if p != "" {
+			target.Provider = &p
+		}
+	}
+}
+
+// decodeFindings reads an array of findings, upgrading each from version and
+// passing it to add.
+func decodeFindings(decoder *json.Decoder, version int, add func(*matching.Finding) error) error {
+	token, err := decoder.Token()
+	if err != nil || (token != nil && token != json.Delim('[')) {
+		return errCorruptSession
+	}
+	if token == nil {
+		return nil
+	}
+	for decoder.More() {
+		var finding matching.Finding
+		if version == SessionSchemaVersion {
+			if err := decoder.Decode(&finding); err != nil {
+				return fmt.Errorf("session file is corrupt: %s", err)
+			}
+		} else if err := decodeOldFinding(decoder, version, &finding); err != nil {
+			return err
+		}
+		if err := add(&finding); err != nil {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return errCorruptSession
+	}
+	return nil
+}
+
+func decodeOldFinding(decoder *json.Decoder, version int, finding *matching.Finding) error {
+	var item map[string]interface{}
+	if err := decoder.Decode(&item); err != nil || item == nil {
+		return fmt.Errorf("session file holds a finding that isn't an object")
+	}
+	for i := version; i < SessionSchemaVersion; i++ {
+		if err := sessionMigrations[i].Finding(item); err != nil {
+			return fmt.Errorf("upgrading session file from schema version %d: %s", i, err)
+		}
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, finding); err != nil {
+		return fmt.Errorf("session file is corrupt: %s", err)
+	}
+	return nil
+}
+
+func newerSessionError(version int, doc sessionDocument) error {
+	generator, _ := doc["Version"].(string)
+	if generator == "" {
+		generator = "unknown"
+	}
+	return fmt.Errorf("session file has schema version %d, generated by Gitrob %s, but this version of "+
+		"Gitrob only reads up to schema version %d; please upgrade Gitrob", version, generator, SessionSchemaVersion)
+}
+
+// migrateSessionToV1 upgrades files written before suppressed findings and
+// triage were recorded.
+func migrateSessionToV1(doc sessionDocument) error {
+	if doc["Triage"] == nil {
+		doc["Triage"] = map[string]interface{}{}
+	}
+	if stats, ok := doc["Stats"].(map[string]interface{}); ok && stats["Suppressed"] == nil {
+		stats["Suppressed"] = 0
+	}
+	return nil
+}
+
+// migrateFindingToV1 upgrades findings written before they had categories
+// and fingerprints. Without the matched value, the fingerprint of a finding
+// is its ID, so its triage doesn't carry over to other commits.
+func migrateFindingToV1(finding map[string]interface{}) error {
+	if fingerprint, _ := finding["Fingerprint"].(string); fingerprint == "" {
+		finding["Fingerprint"] = finding["ID"]
+	}
+	if category, _ := finding["Category"].(string); category == "" {
+		finding["Category"] = matching.CategorySecret
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"gitrob/matching"
+)
+
+func TestDecodeSession(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string
+		wantVersion  int
+		wantErr      string
+		wantFindings []string
+		check        func(t *testing.T, s *Session)
+	}{
+		{
+			name:         "version 0",
+			file:         `{"Version":"2.0.0","Stats":{"Findings":1},"Targets":[{"ID":9007199254740993,"Login":"acme"}],"Findings":[{"ID":"f1"}]}`,
+			wantFindings: []string{"f1"},
+			check: func(t *testing.T, s *Session) {
+				if s.Findings[0].Category != matching.CategorySecret {
+					t.Errorf("category = %q, want %q", s.Findings[0].Category, matching.CategorySecret)
+				}
+				if len(s.Suppressed) != 0 || s.Triage == nil || s.Stats.Suppressed != 0 {
+					t.Errorf("suppressed findings %v and triage %v, want them empty", s.Suppressed, s.Triage)
+				}
+				if id := *s.Targets[0].ID; id != 9007199254740993 {
+					t.Errorf("target ID = %d, want 9007199254740993", id)
+				}
+			},
+		},
+		{
+			name: "targets and repositories without a provider",
+			file: `{"SchemaVersion":1,"Targets":[{"ID":7,"Login":"acme","URL":"https://acme.example"}],` +
+				`"Repositories":[{"ID":7,"CloneURL":"https://gitlab.com/acme/api.git"},{"ID":8,"Provider":"github","CloneURL":"https://example.com/api.git"}]}`,
+			wantVersion: 1,
+			check: func(t *testing.T, s *Session) {
+				if got := repositoryKey(s.Repositories[0]); got != "gitlab:7" {
+					t.Errorf("repository key = %q, want gitlab:7 from the clone URL", got)
+				}
+				if got := repositoryKey(s.Repositories[1]); got != "github:8" {
+					t.Errorf("repository key = %q, want the recorded provider github:8", got)
+				}
+				if got := targetKey(s.Targets[0]); got != "github:7" {
+					t.Errorf("target key = %q, want github:7 from the repositories", got)
+				}
+			},
+		},
+		{
+			name:         "version 0 with findings before the version",
+			file:         `{"Findings":[{"ID":"f1","Fingerprint":"fp1","Category":"pii"}],"Version":"2.0.0"}`,
+			wantFindings: []string{"fp1"},
+			check: func(t *testing.T, s *Session) {
+				if s.Findings[0].Category != matching.CategoryPII {
+					t.Errorf("category = %q, want %q", s.Findings[0].Category, matching.CategoryPII)
+				}
+			},
+		},
+		{
+			name:         "current version",
+			file:         `{"SchemaVersion":1,"Version":"3.0.0","Findings":[{"ID":"f1","Fingerprint":"fp1"}],"Suppressed":[{"ID":"f2","Fingerprint":"fp2"}],"Triage":{"fp1":{"Status":"confirmed"}}}`,
+			wantVersion:  1,
+			wantFindings: []string{"fp1"},
+			check: func(t *testing.T, s *Session) {
+				if len(s.Suppressed) != 1 || s.Triage["fp1"].Status != matching.TriageConfirmed {
+					t.Errorf("suppressed findings %v and triage %v, want fp2 and fp1 confirmed", s.Suppressed, s.Triage)
+				}
+			},
+		},
+		{
+			name:        "newer version",
+			file:        `{"SchemaVersion":99,"Version":"9.0.0","Findings":[]}`,
+			wantVersion: 99,
+			wantErr:     "schema version 99, generated by Gitrob 9.0.0",
+		},
+		{
+			name:    "invalid version",
+			file:    `{"SchemaVersion":-1}`,
+			wantErr: "invalid SchemaVersion",
+		},
+		{
+			name:    "not an object",
+			file:    `[]`,
+			wantErr: "corrupt",
+		},
+		{
+			name:        "targets that aren't an array",
+			file:        `{"SchemaVersion":1,"Targets":"acme"}`,
+			wantVersion: 1,
+			wantErr:     "corrupt",
+		},
+		{
+			name:    "finding that isn't an object",
+			file:    `{"Findings":["f1"]}`,
+			wantErr: "isn't an object",
+		},
+		{
+			name:        "truncated",
+			file:        `{"SchemaVersion":1,"Findings":[{"ID":"f1"}`,
+			wantVersion: 1,
+			wantErr:     "corrupt",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var s Session
+			version, err := decodeSession(strings.NewReader(test.file), &s)
+			if version != test.wantVersion {
+				t.Errorf("version = %d, want %d", version, test.wantVersion)
+			}
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(fingerprints(s.Findings), ","); got != strings.Join(test.wantFindings, ",") {
+				t.Errorf("fingerprints = %s, want %s", got, strings.Join(test.wantFindings, ","))
+			}
+			if test.check != nil {
+				test.check(t, &s)
+			}
+		})
+	}
+}
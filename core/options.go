@@ -2,44 +2,137 @@ package core
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 )
 
 type Options struct {
-	BindAddress       *string `json:"-"`
-	CommitDepth       *int
-	Debug             *bool   `json:"-"`
-	GitLabAccessToken *string `json:"-"`
-	GithubAccessToken *string `json:"-"`
-	InMemClone        *bool
-	Load              *string `json:"-"`
-	Logins            []string
-	Mode              *int
-	NoExpandOrgs      *bool
-	Port              *int
-	Save              *string `json:"-"`
-	Silent            *bool   `json:"-"`
-	Threads           *int
+	ArchiveMaxDepth    *int
+	ArchiveMaxSize     *int64
+	BindAddress        *string `json:"-"`
+	CommitDepth        *int
+	ContentExcludes    listFlag `json:"-"`
+	Debug              *bool    `json:"-"`
+	DecodeDepth        *int
+	DisableSignatures  listFlag     `json:"-"`
+	Encrypt            *bool        `json:"-"`
+	Exports            keyValueFlag `json:"-"`
+	GitLabAccessToken  *string      `json:"-"`
+	GitLabReport       *string      `json:"-"`
+	GithubAccessToken  *string      `json:"-"`
+	Identity           *string      `json:"-"`
+	IgnoreSuppressions *bool
+	InMemClone         *bool
+	Load               listFlag `json:"-"`
+	Logins             []string
+	MinConfidence      *string
+	MinSeverity        *string
+	Mode               *int
+	NoContentExcludes  *bool `json:"-"`
+	NoExpandOrgs       *bool
+	Port               *int
+	Recipients         listFlag `json:"-"`
+	Redact             *bool    `json:"-"`
+	Report             *string  `json:"-"`
+	Run                *int     `json:"-"`
+	Save               *string  `json:"-"`
+	SeverityOverrides  *string  `json:"-"`
+	SignaturePaths     listFlag `json:"-"`
+	Silent             *bool    `json:"-"`
+	Store              *string  `json:"-"`
+	Threads            *int
+	Verify             *bool
+	VerifierURLs       keyValueFlag `json:"-"`
+}
+
+type keyValueFlag map[string]string
+
+func (k keyValueFlag) String() string {
+	var pairs []string
+	for key, value := range k {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (k keyValueFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected name=value, got %s", value)
+	}
+	k[parts[0]] = parts[1]
+	return nil
+}
+
+// listFlag collects the values of a repeatable flag. Each value may also hold a
+// comma separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
 }
 
 func ParseOptions() (Options, error) {
+	return parseOptions(flag.CommandLine, os.Args[1:])
+}
+
+func parseOptions(flags *flag.FlagSet, args []string) (Options, error) {
 	options := Options{
-		BindAddress:       flag.String("bind-address", "127.0.0.1", "Address to bind web server to"),
-		CommitDepth:       flag.Int("commit-depth", 500, "Number of repository commits to process"),
-		Debug:             flag.Bool("debug", false, "Print debugging information"),
-		GitLabAccessToken: flag.String("gitlab-access-token", "", "GitLab access token to use for API requests"),
-		GithubAccessToken: flag.String("github-access-token", "", "GitHub access token to use for API requests"),
-		InMemClone:        flag.Bool("in-mem-clone", false, "Clone repositories into memory"),
-		Load:              flag.String("load", "", "Load session file"),
-		Mode:              flag.Int("mode", 1, "Secrets matching mode (see documentation)."),
-		NoExpandOrgs:      flag.Bool("no-expand-orgs", false, "Don't add members to targets when processing organizations"),
-		Port:              flag.Int("port", 9393, "Port to run web server on"),
-		Save:              flag.String("save", "", "Save session to file"),
-		Silent:            flag.Bool("silent", false, "Suppress all output except for errors"),
-		Threads:           flag.Int("threads", 0, "Number of concurrent threads (default number of logical CPUs)"),
+		ArchiveMaxDepth:    flags.Int("archive-max-depth", 2, "Levels of nested archives to unpack (0 disables archive scanning)"),
+		ArchiveMaxSize:     flags.Int64("archive-max-size", 52428800, "Maximum number of bytes to unpack from a single archive"),
+		BindAddress:        flags.String("bind-address", "127.0.0.1", "Address to bind web server to"),
+		CommitDepth:        flags.Int("commit-depth", 500, "Number of repository commits to process"),
+		Debug:              flags.Bool("debug", false, "Print debugging information"),
+		DecodeDepth:        flags.Int("decode-depth", 2, "Levels of base64, hex and URL encoding to decode before content matching"),
+		Encrypt:            flags.Bool("encrypt", false, "Encrypt saved session files with a passphrase from "+SessionPassphraseEnvVariable+" or the terminal"),
+		Exports:            keyValueFlag{},
+		GitLabAccessToken:  flags.String("gitlab-access-token", "", "GitLab access token to use for API requests"),
+		GitLabReport:       flags.String("gitlab-report", "", "Write a GitLab secret detection report of the session to file"),
+		GithubAccessToken:  flags.String("github-access-token", "", "GitHub access token to use for API requests"),
+		Identity:           flags.String("identity", "", "age identity file to decrypt session files with, instead of a passphrase"),
+		IgnoreSuppressions: flags.Bool("ignore-suppressions", false, "Report findings suppressed with gitrob:allow annotations"),
+		InMemClone:         flags.Bool("in-mem-clone", false, "Clone repositories into memory"),
+		MinConfidence:      flags.String("min-confidence", "", "Only report findings with at least this confidence (high, medium, low)"),
+		MinSeverity:        flags.String("min-severity", "", "Only report findings with at least this severity (critical to info)"),
+		Mode:               flags.Int("mode", 1, "Secrets matching mode, or 4 for PII (see documentation)."),
+		NoContentExcludes:  flags.Bool("no-content-excludes", false, "Also match content of lockfiles, minified files and other files excluded by the built-in signatures"),
+		NoExpandOrgs:       flags.Bool("no-expand-orgs", false, "Don't add members to targets when processing organizations"),
+		Port:               flags.Int("port", 9393, "Port to run web server on"),
+		Redact:             flags.Bool("redact", false, "Redact email addresses in saved session files, for sharing"),
+		Report:             flags.String("report", "", "Write a self-contained HTML report of the session to file"),
+		Run:                flags.Int("run", 0, "Serve a run from the -store database instead of scanning"),
+		Save:               flags.String("save", "", "Save session to file"),
+		SeverityOverrides:  flags.String("severity-overrides", "", "JSON file that overrides the severity and confidence of signatures by ID"),
+		Silent:             flags.Bool("silent", false, "Suppress all output except for errors"),
+		Store:              flags.String("store", "", "Database file that runs are written to as they progress"),
+		Threads:            flags.Int("threads", 0, "Number of concurrent threads (default number of logical CPUs)"),
+		Verify:             flags.Bool("verify", false, "Check whether matched secrets are live by calling the issuing service"),
+		VerifierURLs:       keyValueFlag{},
 	}
+	flags.Var(options.Exports, "export", "Write findings, repositories, targets or users to a .csv or .jsonl file, as records=path (repeatable)")
+	flags.Var(options.VerifierURLs, "verifier-url", "Base URL of the service a verifier calls, as name=url (repeatable)")
+	flags.Var(&options.DisableSignatures, "disable-signature", "ID of a built-in or loaded signature, or name of a matcher, to disable (repeatable)")
+	flags.Var(&options.ContentExcludes, "content-exclude", "Glob of files whose content isn't matched, e.g. '**/dist/**' (repeatable)")
+	flags.Var(&options.Load, "load", "Load session file, or merge several session files (repeatable)")
+	flags.Var(&options.Recipients, "recipient", "age public key, or file of keys, to encrypt saved session files to (repeatable)")
+	flags.Var(&options.SignaturePaths, "signatures", "Additional signature file, or directory of signature files, to load (repeatable)")
 
-	flag.Parse()
-	options.Logins = flag.Args()
+	if err := flags.Parse(args); err != nil {
+		return options, err
+	}
+	options.Logins = flags.Args()
 
 	return options, nil
 }
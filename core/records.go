@@ -0,0 +1,242 @@
+package core
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+const (
+	RecordFormatCSV   = "csv"
+	RecordFormatJSONL = "jsonl"
+)
+
+var (
+	RecordFormats = []string{RecordFormatCSV, RecordFormatJSONL}
+	RecordTypes   = []string{"findings", "repositories", "targets", "users"}
+)
+
+// recordTable is a list of findings, repositories, targets or users, written
+// as CSV with its columns or as JSON Lines.
+type recordTable struct {
+	Columns []string
+	Len     int
+	Record  func(i int) interface{}
+	Row     func(i int) []string
+}
+
+func ValidateRecordType(records string) error {
+	for _, name := range RecordTypes {
+		if records == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported records: %s (expected one of %s)", records, strings.Join(RecordTypes, ", "))
+}
+
+func ValidateRecordFormat(format string) error {
+	for _, name := range RecordFormats {
+		if format == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported format: %s (expected one of %s)", format, strings.Join(RecordFormats, ", "))
+}
+
+// recordFormat is the format of a records file, chosen by its extension.
+func recordFormat(location string) (string, error) {
+	switch strings.ToLower(filepath.Ext(location)) {
+	case ".csv":
+		return RecordFormatCSV, nil
+	case ".jsonl", ".ndjson":
+		return RecordFormatJSONL, nil
+	}
+	return "", fmt.Errorf("can't tell the format of %s, expected a .csv or .jsonl file", location)
+}
+
+// recordTable returns the findings, filtered by the thresholds of the
+// options, repositories, targets or users of the session.
+func (s *Session) recordTable(records string) (recordTable, error) {
+	switch records {
+	case "findings":
+		findings, err := s.QueryFindings(nil)
+		if err != nil {
+			return recordTable{}, err
+		}
+		return findingsTable(findings), nil
+	case "repositories":
+		return repositoriesTable(s.Repositories), nil
+	case "targets":
+		return targetsTable(s.Targets), nil
+	case "users":
+		return usersTable(s.Users), nil
+	}
+	return recordTable{}, ValidateRecordType(records)
+}
+
+func findingsTable(findings []*matching.Finding) recordTable {
+	return recordTable{
+		Columns: []string{"ID", "Fingerprint", "Category", "Severity", "Confidence", "Repository", "FilePath", "Line", "Action",
+			"FileSignatureID", "FileSignatureDescription", "ContentSignatureID", "ContentSignatureDescription",
+			"ConfigKey", "RedactedValue", "VerificationStatus", "TriageStatus", "TriageAssignee", "CommitHash",
+			"CommitAuthor", "CommitMessage", "FileURL", "CommitURL", "RepositoryURL"},
+		Len:    len(findings),
+		Record: func(i int) interface{} { return findings[i] },
+		Row: func(i int) []string {
+			f := findings[i]
+			var assignee string
+			if f.Triage != nil {
+				assignee = f.Triage.Assignee
+			}
+			return []string{f.ID, f.Fingerprint, findingCategory(f), f.Severity, f.Confidence,
+				f.RepositoryOwner + "/" + f.RepositoryName, f.FilePath, lineValue(f.Line), f.Action, f.FileSignatureID,
+				f.FileSignatureDescription, f.ContentSignatureID, f.ContentSignatureDescription, f.ConfigKey,
+				f.RedactedValue, f.VerificationStatus, f.TriageStatus(), assignee, f.CommitHash, f.CommitAuthor,
+				strings.TrimSpace(f.CommitMessage), f.FileURL, f.CommitURL, f.RepositoryURL}
+		},
+	}
+}
+
+func repositoriesTable(repositories []*common.Repository) recordTable {
+	return recordTable{
+		Columns: []string{"ID", "Owner", "Name", "FullName", "URL", "CloneURL", "DefaultBranch", "Description", "Homepage"},
+		Len:     len(repositories),
+		Record:  func(i int) interface{} { return repositories[i] },
+		Row: func(i int) []string {
+			r := repositories[i]
+			return []string{int64Value(r.ID), stringValue(r.Owner), stringValue(r.Name), stringValue(r.FullName),
+				stringValue(r.URL), stringValue(r.CloneURL), stringValue(r.DefaultBranch), stringValue(r.Description),
+				stringValue(r.Homepage)}
+		},
+	}
+}
+
+func targetsTable(targets []*common.Owner) recordTable {
+	return recordTable{
+		Columns: []string{"ID", "Login", "Type", "Name", "Email", "URL", "Company", "Blog", "Location", "Bio"},
+		Len:     len(targets),
+		Record:  func(i int) interface{} { return targets[i] },
+		Row: func(i int) []string {
+			t := targets[i]
+			return []string{int64Value(t.ID), stringValue(t.Login), stringValue(t.Type), stringValue(t.Name),
+				stringValue(t.Email), stringValue(t.URL), stringValue(t.Company), stringValue(t.Blog),
+				stringValue(t.Location), stringValue(t.Bio)}
+		},
+	}
+}
+
+func usersTable(users []UserSignature) recordTable {
+	return recordTable{
+		Columns: []string{"Username", "Email", "Role", "URL", "When"},
+		Len:     len(users),
+		Record:  func(i int) interface{} { return users[i] },
+		Row: func(i int) []string {
+			u := users[i]
+			return []string{u.Username, u.Email, u.Role, u.URL, u.When.Format(time.RFC3339)}
+		},
+	}
+}
+
+// lineValue is the line of a finding, which is unknown for file matches.
+func lineValue(line int) string {
+	if line == 0 {
+		return ""
+	}
+	return strconv.Itoa(line)
+}
+
+func int64Value(i *int64) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.FormatInt(*i, 10)
+}
+
+// Write writes the records as CSV, with a header row, or as JSON Lines.
+func (t recordTable) Write(w io.Writer, format string) error {
+	switch format {
+	case RecordFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(t.Columns); err != nil {
+			return err
+		}
+		for i := 0; i < t.Len; i++ {
+			row := t.Row(i)
+			for j := range row {
+				row[j] = csvCell(row[j])
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case RecordFormatJSONL:
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+		for i := 0; i < t.Len; i++ {
+			if err := encoder.Encode(t.Record(i)); err != nil {
+				return err
+			}
+		}
+		return buffered.Flush()
+	}
+	return ValidateRecordFormat(format)
+}
+
+// csvCell keeps spreadsheets from running values from scanned repositories,
+// such as commit messages, as formulas.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ValidateExports checks the records and file extensions of the -export
+// option.
+func ValidateExports(exports map[string]string) error {
+	for records, location := range exports {
+		if err := ValidateRecordType(records); err != nil {
+			return err
+		}
+		if _, err := recordFormat(location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveRecords writes the records of the session given by the -export option,
+// as records=path, to each path, in the format of its extension.
+func (s *Session) SaveRecords(exports map[string]string) error {
+	for records, location := range exports {
+		if err := s.saveRecords(records, location); err != nil {
+			return fmt.Errorf("%s: %s", location, err)
+		}
+	}
+	return nil
+}
+
+func (s *Session) saveRecords(records, location string) error {
+	format, err := recordFormat(location)
+	if err != nil {
+		return err
+	}
+	table, err := s.recordTable(records)
+	if err != nil {
+		return err
+	}
+	return writeOwnerOnly(location, func(w io.Writer) error {
+		return table.Write(w, format)
+	})
+}
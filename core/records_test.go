@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := map[string]string{
+		"":                        "",
+		"plain":                   "plain",
+		"=HYPERLINK(\"x\")":       "'=HYPERLINK(\"x\")",
+		"+1":                      "'+1",
+		"-cmd":                    "'-cmd",
+		"@SUM(A1)":                "'@SUM(A1)",
+		"\tindented":              "'\tindented",
+		"a=b":                     "a=b",
+		"jane@corp.example, =bad": "jane@corp.example, =bad",
+	}
+	for value, want := range tests {
+		if got := csvCell(value); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestSaveRecords(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestSession(t)
+	s.Targets = []*common.Owner{testOwner(common.ProviderGitHub, 1, "acme")}
+	s.Repositories = []*common.Repository{testRepository(2, "https://github.com/acme/api.git")}
+	s.Users = []UserSignature{{Role: "author", Username: "jane", Email: "jane@acme.example"}}
+	s.Findings = []*matching.Finding{{ID: "f1", Fingerprint: "fp1", Severity: matching.SeverityHigh,
+		RepositoryOwner: "acme", RepositoryName: "api", FilePath: "config/.env", Line: 3, ContentSignatureID: "aws-secret-key",
+		CommitMessage: "=cmd|' /C calc'!A0\n"}}
+	s.Triage = map[string]*matching.Triage{"fp1": {Status: matching.TriageConfirmed, Assignee: "joe"}}
+
+	tests := []struct {
+		records, file string
+		want          map[string]string
+	}{
+		{"findings", "findings.csv", map[string]string{"ID": "f1", "Repository": "acme/api", "Line": "3", "ContentSignatureID": "aws-secret-key",
+			"TriageStatus": matching.TriageConfirmed, "TriageAssignee": "joe", "CommitMessage": "'=cmd|' /C calc'!A0"}},
+		{"repositories", "repositories.csv", map[string]string{"ID": "2", "CloneURL": "https://github.com/acme/api.git"}},
+		{"targets", "targets.csv", map[string]string{"ID": "1", "Login": "acme"}},
+		{"users", "users.csv", map[string]string{"Username": "jane", "Role": "author"}},
+		{"findings", "findings.jsonl", map[string]string{"ID": "f1", "Fingerprint": "fp1"}},
+		{"users", "users.jsonl", map[string]string{"username": "jane", "email": "jane@acme.example"}},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			location := filepath.Join(dir, test.file)
+			if err := s.SaveRecords(map[string]string{test.records: location}); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			got := make(map[string]string)
+			if filepath.Ext(test.file) == ".csv" {
+				rows, err := csv.NewReader(f).ReadAll()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(rows) != 2 {
+					t.Fatalf("got %d rows, want a header and a record", len(rows))
+				}
+				for i, column := range rows[0] {
+					got[column] = rows[1][i]
+				}
+			} else {
+				var record map[string]interface{}
+				decoder := json.NewDecoder(f)
+				if err := decoder.Decode(&record); err != nil {
+					t.Fatal(err)
+				}
+				if decoder.More() {
+					t.Error("got more than one record")
+				}
+				for key, value := range record {
+					if text, ok := value.(string); ok {
+						got[key] = text
+					}
+				}
+			}
+			for key, want := range test.want {
+				if got[key] != want {
+					t.Errorf("%s = %q, want %q", key, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateExports(t *testing.T) {
+	tests := []struct {
+		exports map[string]string
+		err     string
+	}{
+		{map[string]string{"findings": "out/findings.csv", "users": "users.JSONL"}, ""},
+		{map[string]string{"commits": "commits.csv"}, "unsupported records"},
+		{map[string]string{"findings": "findings.xlsx"}, "findings.xlsx"},
+	}
+	for _, test := range tests {
+		err := ValidateExports(test.exports)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("ValidateExports(%v) = %v, want %q", test.exports, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package core
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+// Report is the content of a static HTML report of a session.
+type Report struct {
+	Version      string
+	GeneratedAt  time.Time
+	Redacted     bool
+	Stats        *Stats
+	Severities   []ReportCount
+	Targets      []*common.Owner
+	Repositories []*ReportRepository
+	Signatures   []*ReportSignature
+	Users        []UserSignature
+}
+
+type ReportCount struct {
+	Name  string
+	Count int
+}
+
+// ReportRepository groups the findings of a repository, most severe first.
+type ReportRepository struct {
+	Name     string
+	URL      string
+	Severity string
+	Findings []*matching.Finding
+}
+
+// ReportSignature counts the findings of a signature and the repositories
+// they are in.
+type ReportSignature struct {
+	ID           string
+	Description  string
+	Category     string
+	Severity     string
+	Findings     int
+	Repositories int
+}
+
+// NewReport groups the findings of the session, filtered by the thresholds
+// of its options, by repository and by signature.
+func NewReport(s *Session) (*Report, error) {
+	findings, err := s.QueryFindings(nil)
+	if err != nil {
+		return nil, err
+	}
+	matching.SortFindings(findings)
+	stats := s.Stats
+	if stats == nil {
+		stats = &Stats{}
+	}
+	report := &Report{
+		Version:     common.Version,
+		GeneratedAt: time.Now(),
+		Redacted:    s.Redacted,
+		Stats:       stats,
+		Targets:     s.Targets,
+		Users:       s.Users,
+	}
+	severities := make(map[string]int)
+	repositories := make(map[string]*ReportRepository)
+	signatures := make(map[string]*ReportSignature)
+	signatureRepositories := make(map[string]map[string]bool)
+	for _, finding := range findings {
+		severities[finding.Severity]++
+		name := finding.RepositoryOwner + "/" + finding.RepositoryName
+		repository, ok := repositories[name]
+		if !ok {
+			repository = &ReportRepository{Name: name, URL: finding.RepositoryURL, Severity: finding.Severity}
+			repositories[name] = repository
+			report.Repositories = append(report.Repositories, repository)
+		}
+		repository.Findings = append(repository.Findings, finding)
+		id := reportSignatureID(finding)
+		signature, ok := signatures[id]
+		if !ok {
+			signature = &ReportSignature{
+				ID:          id,
+				Description: diffDescription(finding),
+				Category:    findingCategory(finding),
+				Severity:    finding.Severity,
+			}
+			signatures[id] = signature
+			signatureRepositories[id] = make(map[string]bool)
+			report.Signatures = append(report.Signatures, signature)
+		}
+		signature.Findings++
+		signatureRepositories[id][name] = true
+		signature.Repositories = len(signatureRepositories[id])
+	}
+	for _, severity := range []string{matching.SeverityCritical, matching.SeverityHigh, matching.SeverityMedium,
+		matching.SeverityLow, matching.SeverityInfo} {
+		if severities[severity] > 0 {
+			report.Severities = append(report.Severities, ReportCount{Name: severity, Count: severities[severity]})
+		}
+	}
+	// findings are sorted, so the first finding of a group is its most severe
+	sort.SliceStable(report.Repositories, func(i, j int) bool {
+		a, b := report.Repositories[i], report.Repositories[j]
+		if matching.SeverityRank(a.Severity) != matching.SeverityRank(b.Severity) {
+			return matching.SeverityRank(a.Severity) > matching.SeverityRank(b.Severity)
+		}
+		return len(a.Findings) > len(b.Findings)
+	})
+	sort.SliceStable(report.Signatures, func(i, j int) bool {
+		a, b := report.Signatures[i], report.Signatures[j]
+		if matching.SeverityRank(a.Severity) != matching.SeverityRank(b.Severity) {
+			return matching.SeverityRank(a.Severity) > matching.SeverityRank(b.Severity)
+		}
+		return a.Findings > b.Findings
+	})
+	return report, nil
+}
+
+// reportSignatureID is the ID of the content signature of the finding, or of
+// its file signature for file matches.
+func reportSignatureID(finding *matching.Finding) string {
+	if finding.ContentSignatureID != "" {
+		return finding.ContentSignatureID
+	}
+	if finding.FileSignatureID != "" {
+		return finding.FileSignatureID
+	}
+	return diffDescription(finding)
+}
+
+// SaveReport writes the report of the session to location, readable by the
+// owner only.
+func (s *Session) SaveReport(location string) error {
+	return writeOwnerOnly(location, func(w io.Writer) error {
+		return WriteReport(w, s)
+	})
+}
+
+// WriteReport writes a single HTML file, with inline styles and scripts and
+// nothing loaded from the network, that summarizes the session.
+func WriteReport(w io.Writer, s *Session) error {
+	report, err := NewReport(s)
+	if err != nil {
+		return err
+	}
+	return reportTemplate.Execute(w, report)
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"description": diffDescription,
+	"time":        func(t time.Time) string { return t.Format(time.RFC3339) },
+	"value":       stringValue,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta http-equiv="Content-Security-Policy" content="default-src 'none'; style-src 'unsafe-inline'; script-src 'unsafe-inline'">
+    <style type="text/css">
+        body { background: #202020; color: #dddddd; font-family: sans-serif; margin: 20px 40px; }
+        a { color: #8ab4f8; }
+        td, th { border: 1px solid #666666; padding: 6px 10px; text-align: left; vertical-align: top; }
+        table { border-collapse: collapse; margin-bottom: 20px; }
+        summary { cursor: pointer; margin: 8px 0; }
+        input { background: #303030; border: 1px solid #666666; color: #dddddd; padding: 6px; width: 300px; }
+        .muted { color: #999999; }
+        .severity { border-radius: 3px; color: #ffffff; padding: 1px 6px; }
+        .critical { background: #b71c1c; }
+        .high { background: #e65100; }
+        .medium { background: #9e7c00; }
+        .low { background: #2e7d32; }
+        .info { background: #455a64; }
+    </style>
+    <title>Gitrob report</title>
+</head>
+<body>
+<h1>Gitrob report</h1>
+<p class="muted">Generated by Gitrob {{.Version}} at {{time .GeneratedAt}}{{if .Redacted}}, from a redacted session{{end}}.</p>
+<h2>Summary</h2>
+<table>
+    <tr><th>Status</th><td>{{.Stats.Status}}</td></tr>
+    <tr><th>Started</th><td>{{time .Stats.StartedAt}}</td></tr>
+    <tr><th>Finished</th><td>{{if not .Stats.FinishedAt.IsZero}}{{time .Stats.FinishedAt}}{{end}}</td></tr>
+    <tr><th>Targets</th><td>{{.Stats.Targets}}{{range $i, $target := .Targets}}{{if eq $i 0}}: {{else}}, {{end}}{{value $target.Login}}{{end}}</td></tr>
+    <tr><th>Repositories</th><td>{{.Stats.Repositories}}</td></tr>
+    <tr><th>Commits</th><td>{{.Stats.Commits}}</td></tr>
+    <tr><th>Files</th><td>{{.Stats.Files}}</td></tr>
+    <tr><th>Findings</th><td>{{.Stats.Findings}}{{range .Severities}}<br><span class="severity {{.Name}}">{{.Name}}</span> {{.Count}}{{end}}</td></tr>
+    <tr><th>Suppressed</th><td>{{.Stats.Suppressed}}</td></tr>
+    <tr><th>Users</th><td>{{.Stats.Users}}</td></tr>
+</table>
+{{if .Signatures}}
+<h2>Findings by signature</h2>
+<table>
+    <thead><tr><th>Severity</th><th>Signature</th><th>Category</th><th>Findings</th><th>Repositories</th></tr></thead>
+    <tbody>
+    {{range .Signatures}}
+    <tr>
+        <td><span class="severity {{.Severity}}">{{.Severity}}</span></td>
+        <td>{{.Description}} <span class="muted">{{.ID}}</span></td>
+        <td>{{.Category}}</td>
+        <td>{{.Findings}}</td>
+        <td>{{.Repositories}}</td>
+    </tr>
+    {{end}}
+    </tbody>
+</table>
+<h2>Findings by repository</h2>
+<p><input id="filter" type="search" placeholder="Filter findings"></p>
+{{range .Repositories}}
+<details class="repository">
+    <summary><span class="severity {{.Severity}}">{{.Severity}}</span> <a href="{{.URL}}">{{.Name}}</a>
+        <span class="muted">{{len .Findings}} findings</span></summary>
+    <table>
+        <thead><tr><th>Severity</th><th>Path</th><th>Match</th><th>Commit</th><th>Author</th><th>Triage</th></tr></thead>
+        <tbody>
+        {{range .Findings}}
+        <tr class="finding">
+            <td><span class="severity {{.Severity}}">{{.Severity}}</span> {{.Confidence}}</td>
+            <td><a href="{{.FileURL}}">{{.FilePath}}</a></td>
+            <td>{{description .}}{{if .RedactedValue}}<br><span class="muted">{{.RedactedValue}}</span>{{end}}</td>
+            <td><a href="{{.CommitURL}}">{{printf "%.7s" .CommitHash}}</a></td>
+            <td>{{.CommitAuthor}}</td>
+            <td>{{if .Triage}}{{.Triage.Status}}{{if .Triage.Assignee}} ({{.Triage.Assignee}}){{end}}{{end}}</td>
+        </tr>
+        {{end}}
+        </tbody>
+    </table>
+</details>
+{{end}}
+{{else}}
+<p>No findings.</p>
+{{end}}
+{{if .Users}}
+<h2>Users</h2>
+<table>
+    <thead><tr><th>Username</th><th>Email</th><th>Role</th><th>Seen</th></tr></thead>
+    <tbody>
+    {{range .Users}}
+    <tr>
+        <td>{{if .URL}}<a href="{{.URL}}">{{.Username}}</a>{{else}}{{.Username}}{{end}}</td>
+        <td>{{.Email}}</td>
+        <td>{{.Role}}</td>
+        <td>{{time .When}}</td>
+    </tr>
+    {{end}}
+    </tbody>
+</table>
+{{end}}
+<script>
+    (function () {
+        var filter = document.getElementById("filter");
+        if (!filter) {
+            return;
+        }
+        filter.addEventListener("input", function () {
+            var text = filter.value.toLowerCase();
+            document.querySelectorAll("details.repository").forEach(function (repository) {
+                var name = repository.querySelector("summary").textContent.toLowerCase();
+                var nameMatches = name.indexOf(text) !== -1;
+                var shown = 0;
+                repository.querySelectorAll("tr.finding").forEach(function (row) {
+                    var match = nameMatches || row.textContent.toLowerCase().indexOf(text) !== -1;
+                    row.style.display = match ? "" : "none";
+                    if (match) {
+                        shown++;
+                    }
+                });
+                repository.style.display = shown > 0 ? "" : "none";
+                repository.open = text !== "" && shown > 0;
+            });
+        });
+    })();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"gitrob/matching"
+)
+
+func TestNewReport(t *testing.T) {
+	s := newTestSession(t)
+	s.Findings = []*matching.Finding{
+		{RepositoryOwner: "acme", RepositoryName: "web", ContentSignatureID: "slack-token", Severity: matching.SeverityMedium},
+		{RepositoryOwner: "acme", RepositoryName: "api", ContentSignatureID: "aws-secret-key", Severity: matching.SeverityCritical},
+		{RepositoryOwner: "acme", RepositoryName: "web", ContentSignatureID: "aws-secret-key", Severity: matching.SeverityCritical},
+		{RepositoryOwner: "acme", RepositoryName: "web", FileSignatureID: "private-ssh-key", Severity: matching.SeverityHigh},
+	}
+	report, err := NewReport(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repositories, signatures, severities []string
+	for _, repository := range report.Repositories {
+		repositories = append(repositories, repository.Name)
+	}
+	for _, signature := range report.Signatures {
+		signatures = append(signatures, signature.ID)
+	}
+	for _, count := range report.Severities {
+		severities = append(severities, count.Name)
+	}
+	tests := []struct {
+		name      string
+		got, want string
+	}{
+		{"repositories", strings.Join(repositories, ","), "acme/web,acme/api"},
+		{"signatures", strings.Join(signatures, ","), "aws-secret-key,private-ssh-key,slack-token"},
+		{"severities", strings.Join(severities, ","), "critical,high,medium"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s = %s, want %s", test.name, test.got, test.want)
+		}
+	}
+	if aws := report.Signatures[0]; aws.Findings != 2 || aws.Repositories != 2 {
+		t.Errorf("aws-secret-key has %d findings in %d repositories, want 2 in 2", aws.Findings, aws.Repositories)
+	}
+}
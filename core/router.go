@@ -1,15 +1,19 @@
 package core
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/gin-contrib/static"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-contrib/secure"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"gitrob/common"
+	"gitrob/matching"
 )
 
 const (
@@ -69,11 +73,71 @@ func NewRouter(s *Session) *gin.Engine {
 	})
 
 	router.GET("/findings", func(c *gin.Context) {
-		c.JSON(http.StatusOK, s.Findings)
+		offset, limit, err := pageParameters(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		var findings []*matching.Finding
+		var total int
+		if isFiltered(c) {
+			if findings, err = filterFindings(c, s); err == nil {
+				total = len(findings)
+				findings = pageFindings(findings, offset, limit)
+			}
+		} else {
+			findings, total, err = s.QueryFindingPage(offset, limit)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		c.Header("X-Total-Count", strconv.Itoa(total))
+		respondRecords(c, findings, findingsTable(findings))
+	})
+
+	router.GET("/suppressions", func(c *gin.Context) {
+		findings, err := s.QuerySuppressedFindings()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, findings)
+	})
+
+	router.GET("/triage", func(c *gin.Context) {
+		s.Lock()
+		defer s.Unlock()
+		c.JSON(http.StatusOK, s.Triage)
 	})
 
+	router.PUT("/triage/:fingerprint", func(c *gin.Context) {
+		var triage matching.Triage
+		if err := c.ShouldBindJSON(&triage); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		if err := s.SetTriage(c.Param("fingerprint"), &triage); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, triage)
+	})
+
+	router.POST("/diff", diffSessionFiles)
+
 	router.GET("/users", func(c *gin.Context) {
-		c.JSON(http.StatusOK, s.Users)
+		respondRecords(c, s.Users, usersTable(s.Users))
 	})
 
 	router.GET("/users.html", func(c *gin.Context) {
@@ -81,11 +145,11 @@ func NewRouter(s *Session) *gin.Engine {
 	})
 
 	router.GET("/targets", func(c *gin.Context) {
-		c.JSON(http.StatusOK, s.Targets)
+		respondRecords(c, s.Targets, targetsTable(s.Targets))
 	})
 
 	router.GET("/repositories", func(c *gin.Context) {
-		c.JSON(http.StatusOK, s.Repositories)
+		respondRecords(c, s.Repositories, repositoriesTable(s.Repositories))
 	})
 
 	router.GET("/files/:owner/:repo/:commit/*path", fetchFile)
@@ -93,6 +157,177 @@ func NewRouter(s *Session) *gin.Engine {
 	return router
 }
 
+// filterFindings applies the category, severity, confidence, status,
+// min_severity, min_confidence and sort query parameters. category, severity,
+// confidence and status take comma separated lists.
+func filterFindings(c *gin.Context, s *Session) ([]*matching.Finding, error) {
+	minSeverity, minConfidence := c.Query("min_severity"), c.Query("min_confidence")
+	if minSeverity != "" {
+		if err := matching.ValidateSeverity(minSeverity); err != nil {
+			return nil, err
+		}
+	}
+	if minConfidence != "" {
+		if err := matching.ValidateConfidence(minConfidence); err != nil {
+			return nil, err
+		}
+	}
+	severities, confidences := queryList(c, "severity"), queryList(c, "confidence")
+	categories, statuses := queryList(c, "category"), queryList(c, "status")
+	for status := range statuses {
+		if err := matching.ValidateTriageStatus(status); err != nil {
+			return nil, err
+		}
+	}
+
+	findings, err := s.QueryFindings(func(finding *matching.Finding) bool {
+		return finding.MeetsThreshold(minSeverity, minConfidence) &&
+			(len(severities) == 0 || severities[finding.Severity]) &&
+			(len(confidences) == 0 || confidences[finding.Confidence]) &&
+			(len(categories) == 0 || categories[findingCategory(finding)]) &&
+			(len(statuses) == 0 || statuses[finding.TriageStatus()])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.Query("sort") {
+	case "":
+	case "severity":
+		matching.SortFindings(findings)
+	default:
+		return nil, fmt.Errorf("unsupported sort order: %s", c.Query("sort"))
+	}
+	return findings, nil
+}
+
+// isFiltered reports whether the request filters or sorts the findings.
+func isFiltered(c *gin.Context) bool {
+	for _, name := range []string{"min_severity", "min_confidence", "severity", "confidence", "category", "status", "sort"} {
+		if _, ok := c.GetQuery(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pageParameters returns the offset and limit query parameters, with a limit
+// of -1 when there is none.
+func pageParameters(c *gin.Context) (int, int, error) {
+	offset, limit := 0, -1
+	var err error
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", value)
+		}
+	}
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("invalid limit: %s", value)
+		}
+	}
+	return offset, limit, nil
+}
+
+// respondRecords responds with value as JSON, or with the table as CSV or
+// JSON Lines, as the format query parameter or else the Accept header asks.
+func respondRecords(c *gin.Context, value interface{}, table recordTable) {
+	format := c.Query("format")
+	if format == "" {
+		c.Header("Vary", "Accept")
+		switch c.NegotiateFormat(binding.MIMEJSON, "text/csv", "application/x-ndjson", "application/jsonl") {
+		case "text/csv":
+			format = RecordFormatCSV
+		case "application/x-ndjson", "application/jsonl":
+			format = RecordFormatJSONL
+		}
+	}
+	switch format {
+	case "", "json":
+		c.JSON(http.StatusOK, value)
+	case RecordFormatCSV, RecordFormatJSONL:
+		contentType := "text/csv; charset=utf-8"
+		if format == RecordFormatJSONL {
+			contentType = "application/x-ndjson; charset=utf-8"
+		}
+		c.Status(http.StatusOK)
+		c.Header("Content-Type", contentType)
+		if err := table.Write(c.Writer, format); err != nil {
+			_ = c.Error(err)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": fmt.Sprintf("unsupported format: %s (expected one of json, %s)", format,
+				strings.Join(RecordFormats, ", ")),
+		})
+	}
+}
+
+// findingCategory treats findings of sessions saved before categories existed
+// as secrets.
+func findingCategory(finding *matching.Finding) string {
+	if finding.Category == "" {
+		return matching.CategorySecret
+	}
+	return finding.Category
+}
+
+func queryList(c *gin.Context, key string) map[string]bool {
+	values := make(map[string]bool)
+	for _, value := range strings.Split(c.Query(key), ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values[value] = true
+		}
+	}
+	return values
+}
+
+// diffSessionFiles compares the session files uploaded as the old and new
+// fields of a multipart form and responds in the format given by the format
+// query parameter, JSON by default.
+func diffSessionFiles(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if err := ValidateDiffFormat(format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	var sessions [2]Session
+	for i, field := range []string{"old", "new"} {
+		file, _, err := c.Request.FormFile(field)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("%s: %s", field, err),
+			})
+			return
+		}
+		r := bufio.NewReader(file)
+		if hasPrefix(r, ageHeader) {
+			err = fmt.Errorf("encrypted session files can't be uploaded, decrypt them with gitrob export")
+		} else {
+			_, err = sessions[i].Read(r, SessionFileOptions{})
+		}
+		_ = file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("%s: %s", field, err),
+			})
+			return
+		}
+	}
+	contentTypes := map[string]string{
+		"html": "text/html; charset=utf-8",
+		"json": "application/json; charset=utf-8",
+		"text": "text/plain; charset=utf-8",
+	}
+	c.Header("Content-Type", contentTypes[format])
+	c.Status(http.StatusOK)
+	if err := WriteDiff(c.Writer, DiffSessions(&sessions[0], &sessions[1]), format); err != nil {
+		_ = c.Error(err)
+	}
+}
+
 func fetchFile(c *gin.Context) {
 	fileURL := getFileURL(c)
 
@@ -1,11 +1,10 @@
 package core
 
 import (
-	"encoding/json"
 	"fmt"
 	"gitrob/matching"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
-	"io/ioutil"
+	"io"
 	"os"
 	"runtime"
 	"strings"
@@ -15,6 +14,7 @@ import (
 	"gitrob/common"
 	gh "gitrob/github"
 	gl "gitrob/gitlab"
+	"gitrob/verification"
 
 	"github.com/gin-gonic/gin"
 )
@@ -42,6 +42,7 @@ type Stats struct {
 	Commits      int
 	Files        int
 	Findings     int
+	Suppressed   int
 	Users        int
 }
 
@@ -64,8 +65,14 @@ type UserSignature struct {
 type Session struct {
 	sync.Mutex
 	uniqueSignatures map[string]interface{}
+	// findingWriter writes findings read from session files to the store
+	findingWriter *findingWriter
+	// fingerprintKey is the key that personal data is fingerprinted with
+	fingerprintKey []byte
 
+	SchemaVersion   int
 	Version         string
+	Redacted        bool
 	Options         Options        `json:"-"` // do not unmarshal to json on save
 	Out             *common.Logger `json:"-"` // do not unmarshal to json on save
 	Stats           *Stats
@@ -76,9 +83,15 @@ type Session struct {
 	Targets         []*common.Owner
 	Repositories    []*common.Repository
 	Findings        []*matching.Finding
+	Suppressed      []*matching.Finding
+	Triage          map[string]*matching.Triage
 	Users           []UserSignature
-	IsGithubSession bool                `json:"-"` // do not unmarshal to json on save
-	Signatures      matching.Signatures `json:"-"` // do not unmarshal to json on save
+	IsGithubSession bool                    `json:"-"` // do not unmarshal to json on save
+	Signatures      matching.Signatures     `json:"-"` // do not unmarshal to json on save
+	Matchers        matching.Matchers       `json:"-"` // do not unmarshal to json on save
+	Verifiers       *verification.Verifiers `json:"-"` // do not unmarshal to json on save
+	Store           *Store                  `json:"-"` // do not unmarshal to json on save
+	RunID           uint64                  `json:"-"` // do not unmarshal to json on save
 }
 
 func (s *Session) Initialize() {
@@ -87,6 +100,11 @@ func (s *Session) Initialize() {
 	s.InitThreads()
 	s.InitAccessToken()
 	s.InitSignatures()
+	s.InitFingerprintKey()
+	s.InitFindingFilter()
+	s.InitExports()
+	s.InitStore()
+	s.InitVerifiers()
 	s.ValidateTokenConfig()
 	s.InitAPIClient()
 	s.InitRouter()
@@ -94,16 +112,341 @@ func (s *Session) Initialize() {
 }
 
 func (s *Session) InitSignatures() {
-	s.Signatures = matching.Signatures{}
-	err := s.Signatures.Load(*s.Options.Mode)
+	var unused []string
+	var err error
+	s.Signatures, unused, err = LoadSignatures(&s.Options)
 	if err != nil {
 		s.Out.Fatalf("Errorf loading signatures: %s\n", err)
 	}
+	s.Matchers = matching.NewMatchers(&s.Signatures, *s.Options.Mode, s.Options.DisableSignatures)
+	for _, id := range unused {
+		s.Out.Warnf("Severity override for %s doesn't match a signature loaded in mode %d\n", id, *s.Options.Mode)
+	}
+}
+
+// LoadSignatures loads the built-in signatures and those given with
+// -signatures, removes the disabled ones, ignoring names of matchers, sets up
+// the content exclusions and applies the severity overrides.
+// It also returns the IDs of overrides that didn't match a loaded or built-in
+// matcher signature.
+func LoadSignatures(options *Options) (matching.Signatures, []string, error) {
+	signatures := matching.Signatures{}
+	var disabled []string
+	for _, id := range options.DisableSignatures {
+		if !matching.IsMatcher(id) && id != verification.MatcherName {
+			disabled = append(disabled, id)
+		}
+	}
+	err := signatures.Load(*options.Mode, options.SignaturePaths, disabled)
+	if err != nil {
+		return signatures, nil, err
+	}
+	if *options.NoContentExcludes {
+		signatures.RemoveDefaultContentExclusions()
+	}
+	for _, glob := range options.ContentExcludes {
+		signatures.AddContentExclusion(glob)
+	}
+	if *options.SeverityOverrides == "" {
+		return signatures, nil, nil
+	}
+	overrides, err := matching.LoadSeverityOverrides(*options.SeverityOverrides)
+	if err != nil {
+		return signatures, nil, err
+	}
+	unused, err := signatures.ApplyOverrides(overrides)
+	return signatures, unused, err
+}
+
+// InitFingerprintKey loads the key that personal data is fingerprinted with in
+// mode 4.
+func (s *Session) InitFingerprintKey() {
+	if *s.Options.Mode != matching.ModePII {
+		return
+	}
+	key, err := loadFingerprintKey()
+	if err != nil {
+		s.Out.Fatalf("Errorf loading the fingerprint key: %s\n", err)
+	}
+	s.fingerprintKey = key
+}
+
+func (s *Session) InitFindingFilter() {
+	if *s.Options.MinSeverity != "" {
+		if err := matching.ValidateSeverity(*s.Options.MinSeverity); err != nil {
+			s.Out.Fatalf("Errorf in -min-severity: %s\n", err)
+		}
+	}
+	if *s.Options.MinConfidence != "" {
+		if err := matching.ValidateConfidence(*s.Options.MinConfidence); err != nil {
+			s.Out.Fatalf("Errorf in -min-confidence: %s\n", err)
+		}
+	}
+	// findings of a loaded session are filtered the same way as new ones
+	var findings []*matching.Finding
+	for _, finding := range s.Findings {
+		if finding.MeetsThreshold(*s.Options.MinSeverity, *s.Options.MinConfidence) {
+			findings = append(findings, finding)
+		}
+	}
+	if len(findings) != len(s.Findings) {
+		s.Findings = findings
+		s.Stats.Findings = len(findings)
+	}
+}
+
+func (s *Session) InitExports() {
+	if err := ValidateExports(s.Options.Exports); err != nil {
+		s.Out.Fatalf("Errorf in -export: %s\n", err)
+	}
+}
+
+// InitStore opens the -store database. With -run the stored run is served,
+// otherwise a new run is created holding the loaded session, if any. Without
+// -store, the triage file is merged into the triage of the loaded session.
+// Findings stay in the database rather than in memory and are read by
+// QueryFindings.
+func (s *Session) InitStore() {
+	if *s.Options.Store == "" {
+		if *s.Options.Run != 0 {
+			s.Out.Fatalf("-run requires -store\n")
+		}
+		if s.Triage == nil {
+			s.Triage = make(map[string]*matching.Triage)
+		}
+		if location := s.Options.TriageFile(); location != "" {
+			triage, err := loadTriageFile(location)
+			if err != nil {
+				s.Out.Fatalf("Errorf loading triage from %s: %s\n", location, err)
+			}
+			matching.MergeTriage(s.Triage, triage)
+		}
+		return
+	}
+	var err error
+	if s.Store != nil {
+		// the findings of the loaded session were written as they were read
+		if err := s.Store.PutSession(s.RunID, s); err != nil {
+			s.Out.Fatalf("Errorf writing run %d: %s\n", s.RunID, err)
+		}
+	} else if s.Store, err = OpenStore(*s.Options.Store); err != nil {
+		s.Out.Fatalf("Errorf opening store: %s\n", err)
+	} else if *s.Options.Run != 0 {
+		s.RunID = uint64(*s.Options.Run)
+		if err := s.Store.LoadSession(s.RunID, s); err != nil {
+			s.Out.Fatalf("Errorf loading run %d: %s\n", s.RunID, err)
+		}
+	} else if s.RunID, err = s.Store.CreateRun(s); err != nil {
+		s.Out.Fatalf("Errorf creating run: %s\n", err)
+	}
+	if s.Triage, err = s.Store.Triage(); err != nil {
+		s.Out.Fatalf("Errorf loading triage: %s\n", err)
+	}
+}
+
+// SetTriage records the triage of the findings with the fingerprint in the
+// store, or else in the triage file. A triage without status, assignee and
+// notes is removed.
+func (s *Session) SetTriage(fingerprint string, triage *matching.Triage) error {
+	if triage.Status == "" {
+		triage.Status = matching.TriageUntriaged
+	}
+	if err := matching.ValidateTriageStatus(triage.Status); err != nil {
+		return err
+	}
+	triage.UpdatedAt = time.Now()
+	remove := triage.Status == matching.TriageUntriaged && triage.Assignee == "" && triage.Notes == ""
+	s.Lock()
+	defer s.Unlock()
+	if s.Store != nil {
+		var err error
+		if remove {
+			err = s.Store.DeleteTriage(fingerprint)
+		} else {
+			err = s.Store.PutTriage(fingerprint, triage)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if remove {
+		delete(s.Triage, fingerprint)
+	} else {
+		s.Triage[fingerprint] = triage
+	}
+	if location := s.Options.TriageFile(); s.Store == nil && location != "" {
+		return saveTriageFile(location, s.Triage)
+	}
+	return nil
+}
+
+// QueryFindings returns the findings that meet the -min-severity and
+// -min-confidence thresholds and for which keep returns true, with their
+// triage, reading them from the store when there is one.
+func (s *Session) QueryFindings(keep func(*matching.Finding) bool) ([]*matching.Finding, error) {
+	s.Lock()
+	defer s.Unlock()
+	accept := func(finding *matching.Finding) bool {
+		finding.Triage = s.Triage[finding.Fingerprint]
+		return finding.MeetsThreshold(*s.Options.MinSeverity, *s.Options.MinConfidence) && (keep == nil || keep(finding))
+	}
+	if s.Store != nil {
+		s.flushFindings()
+		return s.Store.Findings(s.RunID, accept)
+	}
+	findings := make([]*matching.Finding, 0, len(s.Findings))
+	for _, finding := range s.Findings {
+		if accept(finding) {
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// QueryFindingPage returns up to limit findings that meet the -min-severity
+// and -min-confidence thresholds from offset on, or all of them when limit is
+// negative, with their triage, and the number of findings on all pages. With a
+// store only the findings of the page are read into memory.
+func (s *Session) QueryFindingPage(offset, limit int) ([]*matching.Finding, int, error) {
+	if s.Store == nil {
+		findings, err := s.QueryFindings(nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		return pageFindings(findings, offset, limit), len(findings), nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.flushFindings()
+	findings, total, err := s.Store.FindingsPage(s.RunID, offset, limit, *s.Options.MinSeverity, *s.Options.MinConfidence)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, finding := range findings {
+		finding.Triage = s.Triage[finding.Fingerprint]
+	}
+	return findings, total, nil
+}
+
+// pageFindings returns up to limit findings from offset on, or all of them
+// when limit is negative.
+func pageFindings(findings []*matching.Finding, offset, limit int) []*matching.Finding {
+	if offset > len(findings) {
+		offset = len(findings)
+	}
+	if limit < 0 || limit > len(findings)-offset {
+		limit = len(findings) - offset
+	}
+	return findings[offset : offset+limit]
+}
+
+// eachFinding calls fn with the findings, or the suppressed findings, one at
+// a time, reading them from the store when there is one.
+func (s *Session) eachFinding(suppressed bool, fn func(*matching.Finding) error) error {
+	if s.Store != nil {
+		s.FlushFindings()
+		bucket := findingsBucket
+		if suppressed {
+			bucket = suppressedBucket
+		}
+		return s.Store.eachFinding(s.RunID, bucket, func(finding *matching.Finding) error {
+			finding.Triage = s.Triage[finding.Fingerprint]
+			return fn(finding)
+		})
+	}
+	findings := s.Findings
+	if suppressed {
+		findings = s.Suppressed
+	}
+	for _, finding := range findings {
+		if err := fn(finding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeFinding queues a finding of the analysis for the store, which writes
+// it with the rest of its batch. The caller holds the lock.
+func (s *Session) storeFinding(finding *matching.Finding, suppressed bool) {
+	if s.findingWriter == nil {
+		s.findingWriter = &findingWriter{store: s.Store, run: s.RunID}
+	}
+	if err := s.findingWriter.add(finding, suppressed); err != nil {
+		s.Out.Errorf("Errorf writing to store: %s\n", err)
+	}
+}
+
+// FlushFindings writes the findings queued for the store, which happens after
+// each repository, at the end of the analysis and before findings are read.
+func (s *Session) FlushFindings() {
+	s.Lock()
+	defer s.Unlock()
+	s.flushFindings()
+}
+
+func (s *Session) flushFindings() {
+	if s.findingWriter == nil {
+		return
+	}
+	if err := s.findingWriter.flush(); err != nil {
+		s.Out.Errorf("Errorf writing to store: %s\n", err)
+	}
+}
+
+// loadFinding adds a finding read from a session file, writing it to the
+// store rather than holding it in memory when loading into a store.
+func (s *Session) loadFinding(finding *matching.Finding, suppressed bool) error {
+	switch {
+	case s.findingWriter != nil:
+		return s.findingWriter.add(finding, suppressed)
+	case suppressed:
+		s.Suppressed = append(s.Suppressed, finding)
+	default:
+		s.Findings = append(s.Findings, finding)
+	}
+	return nil
+}
+
+// QuerySuppressedFindings returns the suppressed findings, reading them from
+// the store when there is one.
+func (s *Session) QuerySuppressedFindings() ([]*matching.Finding, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.Store != nil {
+		s.flushFindings()
+		return s.Store.SuppressedFindings(s.RunID)
+	}
+	return append([]*matching.Finding{}, s.Suppressed...), nil
+}
+
+func (s *Session) InitVerifiers() {
+	if !*s.Options.Verify {
+		return
+	}
+	var err error
+	s.Verifiers, err = verification.NewVerifiers(s.Options.VerifierURLs, verification.DefaultTimeout)
+	if err != nil {
+		s.Out.Fatalf("Errorf initializing verifiers: %s\n", err)
+	}
+	for _, name := range s.Options.DisableSignatures {
+		if name == verification.MatcherName {
+			return
+		}
+	}
+	// verification runs first, so that key inspection doesn't downgrade live keys
+	s.Matchers.Inspectors = append([]matching.Inspector{s.Verifiers}, s.Matchers.Inspectors...)
 }
 
 func (s *Session) Finish() {
+	s.FlushFindings()
 	s.Stats.FinishedAt = time.Now()
 	s.Stats.Status = StatusFinished
+	if s.Store != nil {
+		if err := s.Store.PutStats(s.RunID, s.Version, s.Stats); err != nil {
+			s.Out.Errorf("Errorf writing to store: %s\n", err)
+		}
+	}
 }
 
 func (s *Session) AddTarget(target *common.Owner) {
@@ -115,6 +458,11 @@ func (s *Session) AddTarget(target *common.Owner) {
 		}
 	}
 	s.Targets = append(s.Targets, target)
+	if s.Store != nil {
+		if err := s.Store.PutTarget(s.RunID, target); err != nil {
+			s.Out.Errorf("Errorf writing to store: %s\n", err)
+		}
+	}
 }
 
 func (s *Session) AddRepository(repository *common.Repository) {
@@ -126,19 +474,57 @@ func (s *Session) AddRepository(repository *common.Repository) {
 		}
 	}
 	s.Repositories = append(s.Repositories, repository)
+	if s.Store != nil {
+		if err := s.Store.PutRepository(s.RunID, repository); err != nil {
+			s.Out.Errorf("Errorf writing to store: %s\n", err)
+		}
+	}
 }
 
 func (s *Session) AddFinding(finding *matching.Finding) {
 	s.Lock()
 	defer s.Unlock()
 	const MaxStrLen = 100
-	s.Findings = append(s.Findings, finding)
-	s.Out.Warnf(" %s: %s, %s\n", strings.ToUpper(finding.Action),
+	if !finding.MeetsThreshold(*s.Options.MinSeverity, *s.Options.MinConfidence) {
+		return
+	}
+	if s.Store != nil {
+		s.storeFinding(finding, false)
+	} else {
+		s.Findings = append(s.Findings, finding)
+	}
+	header := s.Out.Warnf
+	if finding.Downgraded {
+		header = s.Out.Infof
+	}
+	header(" %s: %s, %s\n", strings.ToUpper(finding.Action),
 		"File Match: "+finding.FileSignatureDescription, "Content Match: "+finding.ContentSignatureDescription)
+	s.Out.Infof("  Severity..................: %s (%s confidence)\n", finding.Severity, finding.Confidence)
 	s.Out.Infof("  Path......................: %s\n", finding.FilePath)
 	s.Out.Infof("  Repo......................: %s\n", finding.CloneURL)
 	s.Out.Infof("  Message...................: %s\n", common.TruncateString(finding.CommitMessage, MaxStrLen))
 	s.Out.Infof("  Author....................: %s\n", finding.CommitAuthor)
+	if finding.Category == matching.CategoryPII {
+		s.Out.Infof("  Value.....................: %s\n", finding.RedactedValue)
+	}
+	if finding.ConfigKey != "" {
+		s.Out.Infof("  Config Key................: %s\n", finding.ConfigKey)
+	}
+	if finding.KeyMetadata != nil {
+		s.Out.Infof("  Key Material..............: %s\n", finding.KeyMetadata)
+	}
+	if finding.JWT != nil {
+		s.Out.Infof("  JWT.......................: %s\n", finding.JWT)
+	}
+	if len(finding.EncodingChain) > 0 {
+		s.Out.Infof("  Encoding..................: %s\n", strings.Join(finding.EncodingChain, " > "))
+	}
+	if finding.VerificationStatus != "" {
+		s.Out.Infof("  Verification..............: %s (%s)\n", finding.VerificationStatus, finding.Verifier)
+	}
+	if triage, ok := s.Triage[finding.Fingerprint]; ok {
+		s.Out.Infof("  Triage....................: %s\n", triage.Status)
+	}
 	if finding.FileSignatureComment != "" {
 		s.Out.Infof("  FileSignatureComment......: %s\n", common.TruncateString(finding.FileSignatureComment, MaxStrLen))
 	}
@@ -151,6 +537,21 @@ func (s *Session) AddFinding(finding *matching.Finding) {
 	s.Stats.IncrementFindings()
 }
 
+// AddSuppressedFinding records a finding suppressed by a gitrob:allow
+// annotation, so that suppressions can be audited.
+func (s *Session) AddSuppressedFinding(finding *matching.Finding) {
+	s.Lock()
+	defer s.Unlock()
+	if s.Store != nil {
+		s.storeFinding(finding, true)
+	} else {
+		s.Suppressed = append(s.Suppressed, finding)
+	}
+	s.Out.Infof(" SUPPRESSED: %s in %s line %d (%s)\n\n", finding.ContentSignatureDescription, finding.FilePath,
+		finding.Suppression.Line, finding.Suppression.Annotation)
+	s.Stats.IncrementSuppressed()
+}
+
 func (s *Session) AddCommitUsers(commit *object.Commit, url string) {
 	s.Lock()
 	defer s.Unlock()
@@ -173,6 +574,7 @@ func (s *Session) InitStats() {
 		Commits:      0,
 		Files:        0,
 		Findings:     0,
+		Suppressed:   0,
 	}
 }
 
@@ -196,7 +598,7 @@ func (s *Session) InitAccessToken() {
 }
 
 func (s *Session) ValidateTokenConfig() {
-	if *s.Options.Load == "" {
+	if len(s.Options.Load) == 0 && *s.Options.Run == 0 {
 		if s.GitLab.AccessToken != "" && s.Github.AccessToken != "" {
 			s.Out.Fatalf("Both a GitLab and Github token are present.  Only one may be set.\n")
 		}
@@ -246,15 +648,30 @@ func (s *Session) InitFoundUsers() {
 	s.Users = make([]UserSignature, 0)
 }
 
-func (s *Session) SaveToFile(location string) error {
-	sessionJSON, err := json.Marshal(s)
-	if err != nil {
-		return err
+// SaveToFile writes the session readable by the owner only, redacted and
+// encrypted as the options say, and compressed with gzip or zstd when the
+// location ends in .gz or .zst. The session is written to a temporary file
+// that replaces location once complete.
+func (s *Session) SaveToFile(location string, options SessionFileOptions) error {
+	return writeOwnerOnly(location, func(w io.Writer) error {
+		return s.Write(w, sessionCompression(location), options)
+	})
+}
+
+// LoadFromFile reads a session file, decrypting, decompressing and upgrading
+// it as needed.
+func (s *Session) LoadFromFile(location string, options SessionFileOptions) error {
+	if !common.FileExists(location) {
+		return fmt.Errorf("session file does not exist or is not readable: %s", location)
 	}
-	err = ioutil.WriteFile(location, sessionJSON, 0644) //nolint:gosec
+	f, err := os.Open(location)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+	if _, err := s.Read(f, options); err != nil {
+		return fmt.Errorf("%s: %s", err, location)
+	}
 	return nil
 }
 
@@ -271,13 +688,19 @@ func (s *Session) addSignature(sig object.Signature, url, role string) {
 	id := sig.String()
 	if !s.userExists(id) {
 		s.uniqueSignatures[id] = struct{}{}
-		s.Users = append(s.Users, UserSignature{
+		user := UserSignature{
 			Role:     role,
 			Username: sig.Name,
 			Email:    sig.Email,
 			URL:      url,
 			When:     sig.When,
-		})
+		}
+		s.Users = append(s.Users, user)
+		if s.Store != nil {
+			if err := s.Store.AddUser(s.RunID, user); err != nil {
+				s.Out.Errorf("Errorf writing to store: %s\n", err)
+			}
+		}
 		s.Stats.IncrementUsers()
 	}
 }
@@ -312,6 +735,12 @@ func (s *Stats) IncrementFindings() {
 	s.Findings++
 }
 
+func (s *Stats) IncrementSuppressed() {
+	s.Lock()
+	defer s.Unlock()
+	s.Suppressed++
+}
+
 func (s *Stats) IncrementUsers() {
 	s.Lock()
 	defer s.Unlock()
@@ -329,34 +758,33 @@ func (s *Stats) UpdateProgress(current, total int) {
 }
 
 func NewSession() (*Session, error) {
-	var err error
-	var session Session
-
-	if session.Options, err = ParseOptions(); err != nil {
+	options, err := ParseOptions()
+	if err != nil {
 		return nil, err
 	}
 
-	if *session.Options.Save != "" && common.FileExists(*session.Options.Save) {
-		return nil, fmt.Errorf("file already exists: %s", *session.Options.Save)
+	if *options.Save != "" && common.FileExists(*options.Save) {
+		return nil, fmt.Errorf("file already exists: %s", *options.Save)
 	}
 
-	if *session.Options.Load != "" {
-		if !common.FileExists(*session.Options.Load) {
-			return nil, fmt.Errorf("session file does not exist or is not readable: %s", *session.Options.Load)
+	session := &Session{}
+	if len(options.Load) > 0 {
+		var store *Store
+		if *options.Store != "" && *options.Run == 0 {
+			if store, err = OpenStore(*options.Store); err != nil {
+				return nil, err
+			}
 		}
-		data, err := ioutil.ReadFile(*session.Options.Load)
-		if err != nil {
+		if session, err = LoadSessionFiles(options.Load, options.SessionFile(), store); err != nil {
 			return nil, err
 		}
-		if err := json.Unmarshal(data, &session); err != nil {
-			return nil, fmt.Errorf("session file is corrupt or generated by an old version of Gitrob: %s", *session.Options.Load)
-		}
 	}
 
+	session.Options = options
 	session.Version = common.Version
 	session.Initialize()
 
-	return &session, nil
+	return session, nil
 }
 
 func credsEqual(commit *object.Commit) bool {
@@ -0,0 +1,390 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitrob/matching"
+
+	"filippo.io/age"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/term"
+)
+
+const (
+	SessionPassphraseEnvVariable = "GITROB_SESSION_PASSPHRASE" //nolint:gosec
+	CompressionGzip              = "gzip"
+	CompressionZstd              = "zstd"
+)
+
+var (
+	// ageHeader starts every binary age file.
+	ageHeader = []byte("age-encryption.org/")
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// SessionFileOptions controls how session files are written and read. The
+// zero value writes and reads plain JSON.
+type SessionFileOptions struct {
+	// Encrypt encrypts with the passphrase from GITROB_SESSION_PASSPHRASE, or
+	// typed in on the terminal.
+	Encrypt bool
+	// Identity is an age identity file to decrypt with. Without it, encrypted
+	// files are decrypted with the passphrase.
+	Identity string
+	// Recipients are age public keys, or files of them, to encrypt to.
+	Recipients []string
+	// Redact removes email addresses from the saved session.
+	Redact bool
+}
+
+func (o *Options) SessionFile() SessionFileOptions {
+	return SessionFileOptions{
+		Encrypt:    *o.Encrypt,
+		Identity:   *o.Identity,
+		Recipients: o.Recipients,
+		Redact:     *o.Redact,
+	}
+}
+
+// encryptWriter returns a writer encrypting to w with the passphrase or
+// recipients of the options.
+func encryptWriter(w io.Writer, options SessionFileOptions) (io.WriteCloser, error) {
+	var recipients []age.Recipient
+	if options.Encrypt {
+		if len(options.Recipients) > 0 {
+			return nil, fmt.Errorf("-encrypt and -recipient can't be combined")
+		}
+		passphrase, err := sessionPassphrase(true)
+		if err != nil {
+			return nil, err
+		}
+		recipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	for _, value := range options.Recipients {
+		parsed, err := parseRecipients(value)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %s: %s", value, err)
+		}
+		recipients = append(recipients, parsed...)
+	}
+	return age.Encrypt(w, recipients...)
+}
+
+// parseRecipients parses an age public key, or reads a file of them.
+func parseRecipients(value string) ([]age.Recipient, error) {
+	if strings.HasPrefix(value, "age1") {
+		recipient, err := age.ParseX25519Recipient(value)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{recipient}, nil
+	}
+	f, err := os.Open(value)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return age.ParseRecipients(f)
+}
+
+// decryptReader returns a reader decrypting r.
+func decryptReader(r io.Reader, options SessionFileOptions) (io.Reader, error) {
+	var identities []age.Identity
+	if options.Identity != "" {
+		f, err := os.Open(options.Identity)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if identities, err = age.ParseIdentities(f); err != nil {
+			return nil, fmt.Errorf("identity %s: %s", options.Identity, err)
+		}
+	} else {
+		passphrase, err := sessionPassphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	decrypted, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting session file: %s", err)
+	}
+	return decrypted, nil
+}
+
+// sessionPassphrase reads the passphrase from GITROB_SESSION_PASSPHRASE or
+// the terminal, asking twice when encrypting.
+func sessionPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(SessionPassphraseEnvVariable); passphrase != "" {
+		return passphrase, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("session file passphrase required: set %s, or use -identity", SessionPassphraseEnvVariable)
+	}
+	fmt.Fprint(os.Stderr, "Session file passphrase: ")
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("empty session file passphrase")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(passphrase, again) {
+			return "", fmt.Errorf("passphrases don't match")
+		}
+	}
+	return string(passphrase), nil
+}
+
+// hasPrefix reports whether the next bytes of r are prefix.
+func hasPrefix(r *bufio.Reader, prefix []byte) bool {
+	data, _ := r.Peek(len(prefix))
+	return bytes.Equal(data, prefix)
+}
+
+// sessionCompression returns the compression of a session file written to
+// location, chosen by its extension.
+func sessionCompression(location string) string {
+	switch strings.ToLower(filepath.Ext(location)) {
+	case ".gz":
+		return CompressionGzip
+	case ".zst", ".zstd":
+		return CompressionZstd
+	}
+	return ""
+}
+
+func compressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+// decompressReader returns a reader decompressing r when it starts with the
+// magic bytes of gzip or zstd.
+func decompressReader(r *bufio.Reader) (io.ReadCloser, error) {
+	switch {
+	case hasPrefix(r, gzipMagic):
+		return gzip.NewReader(r)
+	case hasPrefix(r, zstdMagic):
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return ioutil.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Write writes the session file to w, compressed and encrypted as the options
+// say. Findings are encoded one at a time rather than the whole session at
+// once.
+func (s *Session) Write(w io.Writer, compression string, options SessionFileOptions) error {
+	var closers []io.Closer
+	if options.Encrypt || len(options.Recipients) > 0 {
+		encrypted, err := encryptWriter(w, options)
+		if err != nil {
+			return err
+		}
+		closers = append(closers, encrypted)
+		w = encrypted
+	}
+	compressed, err := compressWriter(w, compression)
+	if err != nil {
+		return err
+	}
+	closers = append(closers, compressed)
+	buffered := bufio.NewWriter(compressed)
+	if err := s.encode(buffered, options.Redact); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads a session file from r, decrypting and decompressing it as needed,
+// and returns the schema version it had.
+func (s *Session) Read(r io.Reader, options SessionFileOptions) (int, error) {
+	buffered := bufio.NewReader(r)
+	if hasPrefix(buffered, ageHeader) {
+		decrypted, err := decryptReader(buffered, options)
+		if err != nil {
+			return 0, err
+		}
+		buffered = bufio.NewReader(decrypted)
+	}
+	decompressed, err := decompressReader(buffered)
+	if err != nil {
+		return 0, fmt.Errorf("decompressing session file: %s", err)
+	}
+	defer decompressed.Close()
+	return decodeSession(decompressed, s)
+}
+
+// encode writes the session as JSON, redacting the email addresses of
+// findings, users and targets when redact is set. It writes the same fields
+// as encoding/json would, with SchemaVersion first.
+func (s *Session) encode(w io.Writer, redact bool) error {
+	e := &sessionEncoder{w: w}
+	e.write("{")
+	e.field("SchemaVersion", SessionSchemaVersion)
+	e.field("Version", s.Version)
+	e.field("Redacted", s.Redacted || redact)
+	e.field("Stats", s.Stats)
+	e.array("Targets", len(s.Targets), func(i int) interface{} {
+		target := s.Targets[i]
+		if redact && target.Email != nil {
+			redacted := *target
+			email := matching.RedactEmail(*target.Email)
+			redacted.Email = &email
+			return &redacted
+		}
+		return target
+	})
+	e.array("Repositories", len(s.Repositories), func(i int) interface{} {
+		return s.Repositories[i]
+	})
+	for _, suppressed := range []bool{false, true} {
+		name := "Findings"
+		if suppressed {
+			name = "Suppressed"
+		}
+		e.stream(name, func(item func(value interface{})) error {
+			return s.eachFinding(suppressed, func(finding *matching.Finding) error {
+				item(encodedFinding(finding, redact))
+				return e.err
+			})
+		})
+	}
+	e.field("Triage", s.Triage)
+	e.array("Users", len(s.Users), func(i int) interface{} {
+		user := s.Users[i]
+		if redact && user.Email != "" {
+			user.Email = matching.RedactEmail(user.Email)
+		}
+		return user
+	})
+	e.write("}\n")
+	return e.err
+}
+
+// encodedFinding returns the finding as saved, redacting a copy of it.
+func encodedFinding(finding *matching.Finding, redact bool) *matching.Finding {
+	if !redact {
+		return finding
+	}
+	redacted := *finding
+	redacted.Redact()
+	return &redacted
+}
+
+// sessionEncoder writes a JSON object field by field, keeping the first error.
+type sessionEncoder struct {
+	w      io.Writer
+	fields int
+	err    error
+}
+
+func (e *sessionEncoder) write(text string) {
+	if e.err == nil {
+		_, e.err = io.WriteString(e.w, text)
+	}
+}
+
+func (e *sessionEncoder) value(value interface{}) {
+	if e.err != nil {
+		return
+	}
+	var data []byte
+	if data, e.err = json.Marshal(value); e.err == nil {
+		_, e.err = e.w.Write(data)
+	}
+}
+
+func (e *sessionEncoder) key(name string) {
+	if e.fields > 0 {
+		e.write(",")
+	}
+	e.fields++
+	e.write(`"` + name + `":`)
+}
+
+func (e *sessionEncoder) field(name string, value interface{}) {
+	e.key(name)
+	e.value(value)
+}
+
+func (e *sessionEncoder) array(name string, n int, item func(i int) interface{}) {
+	e.stream(name, func(value func(interface{})) error {
+		for i := 0; i < n; i++ {
+			value(item(i))
+		}
+		return nil
+	})
+}
+
+// stream writes the values that each passes to item as an array, so that
+// they needn't be held in memory.
+func (e *sessionEncoder) stream(name string, each func(item func(value interface{})) error) {
+	e.key(name)
+	e.write("[")
+	n := 0
+	err := each(func(value interface{}) {
+		if n > 0 {
+			e.write(",")
+		}
+		n++
+		e.value(value)
+	})
+	if e.err == nil {
+		e.err = err
+	}
+	e.write("]")
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitrob/common"
+	"gitrob/matching"
+
+	"filippo.io/age"
+)
+
+// testSessionFileSession returns a finished session with an email address in
+// every place that redaction removes them from.
+func testSessionFileSession() *Session {
+	email := "jane@acme.example"
+	target := testOwner(common.ProviderGitHub, 1, "acme")
+	target.Email = &email
+	return &Session{
+		Version:      "3.0.0",
+		Stats:        &Stats{Status: StatusFinished, Findings: 1},
+		Targets:      []*common.Owner{target},
+		Repositories: []*common.Repository{testRepository(2, "https://github.com/acme/api.git")},
+		Findings: []*matching.Finding{{ID: "f1", Fingerprint: "fp1", CommitAuthor: "Jane <jane@acme.example>",
+			CommitMessage: "Add key for jane@acme.example"}},
+		Suppressed: make([]*matching.Finding, 0),
+		Triage:     map[string]*matching.Triage{"fp1": {Status: matching.TriageConfirmed}},
+		Users:      []UserSignature{{Role: "author", Username: "jane", Email: email}},
+	}
+}
+
+func TestSessionFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(SessionPassphraseEnvVariable, "correct horse battery staple")
+
+	tests := []struct {
+		name       string
+		file       string
+		write      SessionFileOptions
+		read       SessionFileOptions
+		wantPrefix []byte
+		redacted   bool
+	}{
+		{name: "plain", file: "plain.json", wantPrefix: []byte(`{"SchemaVersion":1`)},
+		{name: "passphrase", file: "passphrase.json", write: SessionFileOptions{Encrypt: true}, wantPrefix: ageHeader},
+		{
+			name:       "recipient",
+			file:       "recipient.json",
+			write:      SessionFileOptions{Recipients: []string{identity.Recipient().String()}},
+			read:       SessionFileOptions{Identity: identityFile},
+			wantPrefix: ageHeader,
+		},
+		{name: "redacted", file: "redacted.json", write: SessionFileOptions{Redact: true}, redacted: true},
+		{name: "gzip", file: "gzip.json.gz", wantPrefix: gzipMagic},
+		{name: "zstd", file: "zstd.json.zst", wantPrefix: zstdMagic},
+		{name: "encrypted zstd", file: "encrypted.json.zst", write: SessionFileOptions{Encrypt: true}, wantPrefix: ageHeader},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location := filepath.Join(dir, test.file)
+			if err := testSessionFileSession().SaveToFile(location, test.write); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := info.Mode().Perm(); mode != 0600 {
+				t.Errorf("mode = %o, want 600", mode)
+			}
+			data, err := os.ReadFile(location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(data, test.wantPrefix) {
+				t.Errorf("file starts with %q, want %q", data[:16], test.wantPrefix)
+			}
+
+			var loaded Session
+			if err := loaded.LoadFromFile(location, test.read); err != nil {
+				t.Fatal(err)
+			}
+			if got := fingerprints(loaded.Findings); len(got) != 1 || got[0] != "fp1" {
+				t.Errorf("loaded findings %q, want [fp1]", got)
+			}
+			if loaded.Triage["fp1"] == nil || len(loaded.Users) != 1 || len(loaded.Targets) != 1 {
+				t.Errorf("loaded triage %v, users %v and targets %v, want one of each", loaded.Triage, loaded.Users, loaded.Targets)
+			}
+			if loaded.Redacted != test.redacted {
+				t.Errorf("Redacted = %v, want %v", loaded.Redacted, test.redacted)
+			}
+			emails := []string{loaded.Findings[0].CommitAuthor, loaded.Findings[0].CommitMessage, *loaded.Targets[0].Email,
+				loaded.Users[0].Email}
+			for _, email := range emails {
+				if strings.Contains(email, "jane@") == test.redacted {
+					t.Errorf("email in %q, want it redacted: %v", email, test.redacted)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionFileDecryptErrors(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(SessionPassphraseEnvVariable, "correct horse battery staple")
+	location := filepath.Join(dir, "session.json")
+	if err := testSessionFileSession().SaveToFile(location, SessionFileOptions{Encrypt: true}); err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(dir, "other.txt")
+	if err := os.WriteFile(identityFile, []byte(other.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		options    SessionFileOptions
+	}{
+		{name: "wrong passphrase", passphrase: "wrong"},
+		{name: "wrong identity", options: SessionFileOptions{Identity: identityFile}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.passphrase != "" {
+				t.Setenv(SessionPassphraseEnvVariable, test.passphrase)
+			}
+			var loaded Session
+			err := loaded.LoadFromFile(location, test.options)
+			if err == nil || !strings.Contains(err.Error(), "decrypting session file") {
+				t.Errorf("error = %v, want a decryption error", err)
+			}
+		})
+	}
+	if err := testSessionFileSession().SaveToFile(location, SessionFileOptions{Encrypt: true, Recipients: []string{other.Recipient().String()}}); err == nil {
+		t.Error("saving with -encrypt and -recipient succeeded, want an error")
+	}
+}
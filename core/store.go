@@ -0,0 +1,548 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gitrob/common"
+	"gitrob/matching"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	runsBucket         = []byte("runs")
+	runKey             = []byte("run")
+	targetsBucket      = []byte("targets")
+	repositoriesBucket = []byte("repositories")
+	findingsBucket     = []byte("findings")
+	suppressedBucket   = []byte("suppressed")
+	usersBucket        = []byte("users")
+	triageBucket       = []byte("triage")
+)
+
+// Store persists sessions in a bbolt database so that a scan is written as it
+// progresses and findings can be queried without loading them all. Every
+// scan or imported session file is a run. Triage is shared by all runs.
+type Store struct {
+	db *bolt.DB
+}
+
+// Run describes a stored session.
+type Run struct {
+	ID      uint64
+	Version string
+	Stats   *Stats
+}
+
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening store %s: %s", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(runsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(triageBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (st *Store) Close() error {
+	return st.db.Close()
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+func runBucket(tx *bolt.Tx, run uint64) (*bolt.Bucket, error) {
+	b := tx.Bucket(runsBucket).Bucket(itob(run))
+	if b == nil {
+		return nil, fmt.Errorf("run %d does not exist", run)
+	}
+	return b, nil
+}
+
+// CreateRun stores the session as a new run and returns its ID.
+func (st *Store) CreateRun(s *Session) (uint64, error) {
+	var id uint64
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if id, err = createRun(tx); err != nil {
+			return err
+		}
+		b := tx.Bucket(runsBucket).Bucket(itob(id))
+		if err := putSession(tx, b, id, s); err != nil {
+			return err
+		}
+		return appendFindings(b, s.Findings, s.Suppressed)
+	})
+	return id, err
+}
+
+// NewRun creates an empty run and returns its ID, for a session whose
+// findings are added as they are read.
+func (st *Store) NewRun() (uint64, error) {
+	var id uint64
+	err := st.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		id, err = createRun(tx)
+		return err
+	})
+	return id, err
+}
+
+// PutSession stores the session in the run, except for its findings.
+func (st *Store) PutSession(run uint64, s *Session) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b, err := runBucket(tx, run)
+		if err != nil {
+			return err
+		}
+		return putSession(tx, b, run, s)
+	})
+}
+
+// DeleteRun removes the run.
+func (st *Store) DeleteRun(run uint64) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(runsBucket).DeleteBucket(itob(run))
+	})
+}
+
+func createRun(tx *bolt.Tx) (uint64, error) {
+	runs := tx.Bucket(runsBucket)
+	id, err := runs.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	b, err := runs.CreateBucket(itob(id))
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range [][]byte{targetsBucket, repositoriesBucket, findingsBucket, suppressedBucket, usersBucket} {
+		if _, err := b.CreateBucket(name); err != nil {
+			return 0, err
+		}
+	}
+	return id, putJSON(b, runKey, Run{ID: id})
+}
+
+func putSession(tx *bolt.Tx, b *bolt.Bucket, id uint64, s *Session) error {
+	if err := putJSON(b, runKey, Run{ID: id, Version: s.Version, Stats: s.Stats}); err != nil {
+		return err
+	}
+	for _, target := range s.Targets {
+		if err := putKeyedJSON(b.Bucket(targetsBucket), targetKey(target), target); err != nil {
+			return err
+		}
+	}
+	for _, repository := range s.Repositories {
+		if err := putKeyedJSON(b.Bucket(repositoriesBucket), repositoryKey(repository), repository); err != nil {
+			return err
+		}
+	}
+	for _, user := range s.Users {
+		if err := appendJSON(b.Bucket(usersBucket), user); err != nil {
+			return err
+		}
+	}
+	return mergeTriage(tx, s.Triage)
+}
+
+func appendFindings(b *bolt.Bucket, findings, suppressed []*matching.Finding) error {
+	for _, finding := range findings {
+		if err := appendJSON(b.Bucket(findingsBucket), finding); err != nil {
+			return err
+		}
+	}
+	for _, finding := range suppressed {
+		if err := appendJSON(b.Bucket(suppressedBucket), finding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeTriage adds the triage of an imported session, keeping the stored
+// triage of a fingerprint when it is more recent.
+func mergeTriage(tx *bolt.Tx, triage map[string]*matching.Triage) error {
+	b := tx.Bucket(triageBucket)
+	for fingerprint, t := range triage {
+		if data := b.Get([]byte(fingerprint)); data != nil {
+			var stored matching.Triage
+			if err := json.Unmarshal(data, &stored); err != nil {
+				return err
+			}
+			if !stored.UpdatedAt.Before(t.UpdatedAt) {
+				continue
+			}
+		}
+		if err := putJSON(b, []byte(fingerprint), t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *Store) PutTriage(fingerprint string, triage *matching.Triage) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(triageBucket), []byte(fingerprint), triage)
+	})
+}
+
+func (st *Store) DeleteTriage(fingerprint string) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(triageBucket).Delete([]byte(fingerprint))
+	})
+}
+
+// Triage returns the triage of all fingerprints.
+func (st *Store) Triage() (map[string]*matching.Triage, error) {
+	triage := make(map[string]*matching.Triage)
+	err := st.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(triageBucket).ForEach(func(k, v []byte) error {
+			var t matching.Triage
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			triage[string(k)] = &t
+			return nil
+		})
+	})
+	return triage, err
+}
+
+func appendJSON(b *bolt.Bucket, v interface{}) error {
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	return putJSON(b, itob(seq), v)
+}
+
+// putKeyedJSON stores targets and repositories by the key MergeSessions
+// deduplicates them by, since their IDs can collide across GitHub and GitLab.
+func putKeyedJSON(b *bolt.Bucket, key string, v interface{}) error {
+	if key == "" {
+		return appendJSON(b, v)
+	}
+	return putJSON(b, []byte(key), v)
+}
+
+func (st *Store) update(run uint64, fn func(b *bolt.Bucket) error) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b, err := runBucket(tx, run)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+func (st *Store) PutStats(run uint64, version string, stats *Stats) error {
+	return st.update(run, func(b *bolt.Bucket) error {
+		return putJSON(b, runKey, Run{ID: run, Version: version, Stats: stats})
+	})
+}
+
+func (st *Store) PutTarget(run uint64, target *common.Owner) error {
+	return st.update(run, func(b *bolt.Bucket) error {
+		return putKeyedJSON(b.Bucket(targetsBucket), targetKey(target), target)
+	})
+}
+
+func (st *Store) PutRepository(run uint64, repository *common.Repository) error {
+	return st.update(run, func(b *bolt.Bucket) error {
+		return putKeyedJSON(b.Bucket(repositoriesBucket), repositoryKey(repository), repository)
+	})
+}
+
+func (st *Store) AddUser(run uint64, user UserSignature) error {
+	return st.update(run, func(b *bolt.Bucket) error {
+		return appendJSON(b.Bucket(usersBucket), user)
+	})
+}
+
+// findingBatchSize is the number of findings a findingWriter writes in a
+// transaction.
+const findingBatchSize = 1000
+
+// findingWriter adds findings to a run in batches, rather than in a
+// transaction each. The writer of loaded session files also skips findings
+// with the ID and fingerprint of one already added, as MergeSessions does.
+type findingWriter struct {
+	store      *Store
+	run        uint64
+	seen       map[string]bool
+	findings   []*matching.Finding
+	suppressed []*matching.Finding
+}
+
+// newFindingWriter returns a writer for the findings of loaded session files,
+// which skips duplicates.
+func newFindingWriter(store *Store, run uint64) *findingWriter {
+	return &findingWriter{store: store, run: run, seen: make(map[string]bool)}
+}
+
+func (w *findingWriter) add(finding *matching.Finding, suppressed bool) error {
+	if w.seen != nil {
+		key := "finding:" + finding.ID + finding.Fingerprint
+		if suppressed {
+			key = "suppressed:" + finding.ID + finding.Fingerprint
+		}
+		if w.seen[key] {
+			return nil
+		}
+		w.seen[key] = true
+	}
+	if suppressed {
+		w.suppressed = append(w.suppressed, finding)
+	} else {
+		w.findings = append(w.findings, finding)
+	}
+	if len(w.findings)+len(w.suppressed) < findingBatchSize {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *findingWriter) flush() error {
+	if len(w.findings) == 0 && len(w.suppressed) == 0 {
+		return nil
+	}
+	err := w.store.update(w.run, func(b *bolt.Bucket) error {
+		return appendFindings(b, w.findings, w.suppressed)
+	})
+	w.findings, w.suppressed = w.findings[:0], w.suppressed[:0]
+	return err
+}
+
+// CountFindings returns the number of findings and of suppressed findings of
+// the run.
+func (st *Store) CountFindings(run uint64) (int, int, error) {
+	var findings, suppressed int
+	err := st.db.View(func(tx *bolt.Tx) error {
+		b, err := runBucket(tx, run)
+		if err != nil {
+			return err
+		}
+		findings, suppressed = int(b.Bucket(findingsBucket).Sequence()), int(b.Bucket(suppressedBucket).Sequence())
+		return nil
+	})
+	return findings, suppressed, err
+}
+
+// Runs returns all runs, oldest first.
+func (st *Store) Runs() ([]Run, error) {
+	var runs []Run
+	err := st.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(runsBucket).ForEach(func(k, _ []byte) error {
+			var run Run
+			if err := json.Unmarshal(tx.Bucket(runsBucket).Bucket(k).Get(runKey), &run); err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			return nil
+		})
+	})
+	return runs, err
+}
+
+// LatestRun returns the ID of the most recent run, or 0 when there is none.
+func (st *Store) LatestRun() (uint64, error) {
+	var id uint64
+	err := st.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(runsBucket).Cursor().Last()
+		if k != nil {
+			id = binary.BigEndian.Uint64(k)
+		}
+		return nil
+	})
+	return id, err
+}
+
+func (st *Store) each(run uint64, bucket []byte, fn func(v []byte) error) error {
+	return st.db.View(func(tx *bolt.Tx) error {
+		b, err := runBucket(tx, run)
+		if err != nil {
+			return err
+		}
+		return b.Bucket(bucket).ForEach(func(_, v []byte) error {
+			return fn(v)
+		})
+	})
+}
+
+// Findings returns the findings of the run for which keep returns true.
+func (st *Store) Findings(run uint64, keep func(*matching.Finding) bool) ([]*matching.Finding, error) {
+	return st.findings(run, findingsBucket, keep)
+}
+
+func (st *Store) SuppressedFindings(run uint64) ([]*matching.Finding, error) {
+	return st.findings(run, suppressedBucket, nil)
+}
+
+func (st *Store) findings(run uint64, bucket []byte, keep func(*matching.Finding) bool) ([]*matching.Finding, error) {
+	findings := make([]*matching.Finding, 0)
+	err := st.eachFinding(run, bucket, func(finding *matching.Finding) error {
+		if keep == nil || keep(finding) {
+			findings = append(findings, finding)
+		}
+		return nil
+	})
+	return findings, err
+}
+
+// eachFinding calls fn with the findings of the bucket of the run one at a
+// time, in the order they were found.
+func (st *Store) eachFinding(run uint64, bucket []byte, fn func(*matching.Finding) error) error {
+	return st.each(run, bucket, func(v []byte) error {
+		var finding matching.Finding
+		if err := json.Unmarshal(v, &finding); err != nil {
+			return err
+		}
+		return fn(&finding)
+	})
+}
+
+// FindingsPage returns up to limit findings of the run that meet the
+// thresholds, or all of them when limit is negative, starting at offset in the
+// order they were found, and the number of findings of the run that meet the
+// thresholds. Findings are keyed by their sequence number, so without
+// thresholds the cursor seeks to the offset and only the page is read. With
+// thresholds every finding is checked, but only the findings of the page are
+// decoded in full.
+func (st *Store) FindingsPage(run uint64, offset, limit int, minSeverity, minConfidence string) ([]*matching.Finding, int, error) {
+	findings := make([]*matching.Finding, 0)
+	var total int
+	err := st.db.View(func(tx *bolt.Tx) error {
+		b, err := runBucket(tx, run)
+		if err != nil {
+			return err
+		}
+		bucket := b.Bucket(findingsBucket)
+		c := bucket.Cursor()
+		if minSeverity == "" && minConfidence == "" {
+			total = int(bucket.Sequence())
+			for k, v := c.Seek(itob(uint64(offset) + 1)); k != nil && (limit < 0 || len(findings) < limit); k, v = c.Next() {
+				var finding matching.Finding
+				if err := json.Unmarshal(v, &finding); err != nil {
+					return err
+				}
+				findings = append(findings, &finding)
+			}
+			return nil
+		}
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var rating struct {
+				Severity, Confidence string
+			}
+			if err := json.Unmarshal(v, &rating); err != nil {
+				return err
+			}
+			rated := matching.Finding{Severity: rating.Severity, Confidence: rating.Confidence}
+			if !rated.MeetsThreshold(minSeverity, minConfidence) {
+				continue
+			}
+			total++
+			if total <= offset || (limit >= 0 && len(findings) >= limit) {
+				continue
+			}
+			var finding matching.Finding
+			if err := json.Unmarshal(v, &finding); err != nil {
+				return err
+			}
+			findings = append(findings, &finding)
+		}
+		return nil
+	})
+	return findings, total, err
+}
+
+// LoadSession reads the run into the session, except for its findings, which
+// are read from the store as they are needed.
+func (st *Store) LoadSession(run uint64, s *Session) error {
+	err := st.db.View(func(tx *bolt.Tx) error {
+		b, err := runBucket(tx, run)
+		if err != nil {
+			return err
+		}
+		var info Run
+		if err := json.Unmarshal(b.Get(runKey), &info); err != nil {
+			return err
+		}
+		s.Version, s.Stats = info.Version, info.Stats
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.Targets, s.Repositories, s.Users = make([]*common.Owner, 0), make([]*common.Repository, 0), make([]UserSignature, 0)
+	err = st.each(run, targetsBucket, func(v []byte) error {
+		var target common.Owner
+		s.Targets = append(s.Targets, &target)
+		return json.Unmarshal(v, &target)
+	})
+	if err != nil {
+		return err
+	}
+	err = st.each(run, repositoriesBucket, func(v []byte) error {
+		var repository common.Repository
+		s.Repositories = append(s.Repositories, &repository)
+		return json.Unmarshal(v, &repository)
+	})
+	if err != nil {
+		return err
+	}
+	fillProviders(s)
+	err = st.each(run, usersBucket, func(v []byte) error {
+		var user UserSignature
+		if err := json.Unmarshal(v, &user); err != nil {
+			return err
+		}
+		s.Users = append(s.Users, user)
+		return nil
+	})
+	return err
+}
+
+// RunTriage returns the triage of the fingerprints of the findings of the run.
+func (st *Store) RunTriage(run uint64) (map[string]*matching.Triage, error) {
+	triage, err := st.Triage()
+	if err != nil {
+		return nil, err
+	}
+	runTriage := make(map[string]*matching.Triage)
+	for _, bucket := range [][]byte{findingsBucket, suppressedBucket} {
+		err := st.eachFinding(run, bucket, func(finding *matching.Finding) error {
+			if t, ok := triage[finding.Fingerprint]; ok {
+				runTriage[finding.Fingerprint] = t
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return runTriage, nil
+}
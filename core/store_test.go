@@ -0,0 +1,377 @@
+package core
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+// newTestSession returns a silent session with the options given as flags.
+func newTestSession(t *testing.T, args ...string) *Session {
+	t.Helper()
+	options, err := parseOptions(flag.NewFlagSet("gitrob", flag.ContinueOnError), append([]string{"-silent"}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Session{Options: options, Triage: make(map[string]*matching.Triage)}
+	s.InitLogger()
+	s.InitStats()
+	return s
+}
+
+// openTestStore opens a store in a temporary directory of the test.
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := OpenStore(filepath.Join(t.TempDir(), "gitrob.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func testOwner(provider string, id int64, login string) *common.Owner {
+	return &common.Owner{Provider: &provider, ID: &id, Login: &login}
+}
+
+// testRepository returns a repository hosted by the provider of its clone URL.
+func testRepository(id int64, cloneURL string) *common.Repository {
+	provider := common.ProviderFromURL(cloneURL)
+	return &common.Repository{Provider: &provider, ID: &id, CloneURL: &cloneURL}
+}
+
+func testFinding(fingerprint, severity string) *matching.Finding {
+	return &matching.Finding{Fingerprint: fingerprint, Severity: severity, Confidence: matching.ConfidenceHigh,
+		FilePath: "config/" + fingerprint, CloneURL: "https://github.com/acme/api.git"}
+}
+
+func fingerprints(findings []*matching.Finding) []string {
+	result := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		result = append(result, finding.Fingerprint)
+	}
+	return result
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	store := openTestStore(t)
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestSession(t)
+	s.Version = "3.0.0"
+	s.Targets = []*common.Owner{testOwner(common.ProviderGitHub, 1, "acme")}
+	s.Repositories = []*common.Repository{testRepository(2, "https://github.com/acme/api.git")}
+	s.Findings = []*matching.Finding{testFinding("a", matching.SeverityHigh), testFinding("b", matching.SeverityLow)}
+	s.Suppressed = []*matching.Finding{testFinding("c", matching.SeverityMedium)}
+	s.Users = []UserSignature{{Role: "author", Username: "jane", Email: "jane@acme.example"}}
+	s.Triage = map[string]*matching.Triage{
+		"a": {Status: matching.TriageConfirmed, UpdatedAt: updated},
+		"z": {Status: matching.TriageFalsePositive, UpdatedAt: updated},
+	}
+	run, err := store.CreateRun(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded Session
+	if err := store.LoadSession(run, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Version != s.Version || len(loaded.Findings) != 0 {
+		t.Errorf("loaded version %q with %d findings, want %q without findings", loaded.Version, len(loaded.Findings), s.Version)
+	}
+	if !reflect.DeepEqual(loaded.Targets, s.Targets) || !reflect.DeepEqual(loaded.Repositories, s.Repositories) {
+		t.Errorf("loaded targets %v and repositories %v, want %v and %v", loaded.Targets, loaded.Repositories, s.Targets, s.Repositories)
+	}
+	if !reflect.DeepEqual(loaded.Users, s.Users) {
+		t.Errorf("loaded users %v, want %v", loaded.Users, s.Users)
+	}
+
+	tests := []struct {
+		name  string
+		query func() ([]*matching.Finding, error)
+		want  []string
+	}{
+		{"findings", func() ([]*matching.Finding, error) { return store.Findings(run, nil) }, []string{"a", "b"}},
+		{"suppressed findings", func() ([]*matching.Finding, error) { return store.SuppressedFindings(run) }, []string{"c"}},
+		{"filtered findings", func() ([]*matching.Finding, error) {
+			return store.Findings(run, func(finding *matching.Finding) bool { return finding.Severity == matching.SeverityLow })
+		}, []string{"b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			findings, err := test.query()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fingerprints(findings); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("fingerprints = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	triage, err := store.RunTriage(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(triage) != 1 || triage["a"] == nil || triage["a"].Status != matching.TriageConfirmed {
+		t.Errorf("run triage = %v, want the triage of a", triage)
+	}
+}
+
+func TestStoreKeys(t *testing.T) {
+	store := openTestStore(t)
+	s := newTestSession(t)
+	s.Targets = []*common.Owner{testOwner(common.ProviderGitHub, 7, "acme"), testOwner(common.ProviderGitLab, 7, "acme")}
+	s.Repositories = []*common.Repository{
+		testRepository(7, "https://github.com/acme/api.git"),
+		testRepository(7, "https://gitlab.com/acme-group/api.git"),
+	}
+	run, err := store.CreateRun(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutTarget(run, testOwner(common.ProviderGitHub, 7, "acme-inc")); err != nil {
+		t.Fatal(err)
+	}
+	var loaded Session
+	if err := store.LoadSession(run, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Targets) != 2 || len(loaded.Repositories) != 2 {
+		t.Errorf("stored %d targets and %d repositories with colliding IDs and logins, want 2 of each", len(loaded.Targets), len(loaded.Repositories))
+	}
+}
+
+func TestStoreMergeTriage(t *testing.T) {
+	store := openTestStore(t)
+	older, newer := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.PutTriage("kept", &matching.Triage{Status: matching.TriageConfirmed, UpdatedAt: newer}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutTriage("replaced", &matching.Triage{Status: matching.TriageConfirmed, UpdatedAt: older}); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestSession(t)
+	s.Triage = map[string]*matching.Triage{
+		"kept":     {Status: matching.TriageFalsePositive, UpdatedAt: older},
+		"replaced": {Status: matching.TriageFalsePositive, UpdatedAt: newer},
+		"added":    {Status: matching.TriageRevoked, UpdatedAt: older},
+	}
+	if _, err := store.CreateRun(s); err != nil {
+		t.Fatal(err)
+	}
+	triage, err := store.Triage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"kept":     matching.TriageConfirmed,
+		"replaced": matching.TriageFalsePositive,
+		"added":    matching.TriageRevoked,
+	}
+	for fingerprint, status := range want {
+		if triage[fingerprint] == nil || triage[fingerprint].Status != status {
+			t.Errorf("triage of %s = %v, want %s", fingerprint, triage[fingerprint], status)
+		}
+	}
+}
+
+func TestFindingsPage(t *testing.T) {
+	store := openTestStore(t)
+	s := newTestSession(t)
+	s.Store = store
+	var err error
+	if s.RunID, err = store.CreateRun(s); err != nil {
+		t.Fatal(err)
+	}
+	for _, fingerprint := range []string{"a", "b", "c", "d", "e"} {
+		s.AddFinding(testFinding(fingerprint, matching.SeverityHigh))
+	}
+	if s.Findings != nil {
+		t.Fatalf("session holds %d findings with a store", len(s.Findings))
+	}
+	if stored, _, err := store.CountFindings(s.RunID); err != nil || stored != 0 {
+		t.Errorf("store holds %d findings before they are flushed, want them written in one batch", stored)
+	}
+	s.FlushFindings()
+	if stored, _, err := store.CountFindings(s.RunID); err != nil || stored != 5 {
+		t.Errorf("store holds %d findings after they are flushed, want 5", stored)
+	}
+
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []string
+	}{
+		{"all", 0, -1, []string{"a", "b", "c", "d", "e"}},
+		{"first page", 0, 2, []string{"a", "b"}},
+		{"middle page", 2, 2, []string{"c", "d"}},
+		{"last page", 4, 2, []string{"e"}},
+		{"past the end", 7, 2, []string{}},
+		{"empty page", 1, 0, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			findings, total, err := s.QueryFindingPage(test.offset, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 5 {
+				t.Errorf("total = %d, want 5", total)
+			}
+			if got := fingerprints(findings); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("fingerprints = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindingsPageWithThresholds(t *testing.T) {
+	store := openTestStore(t)
+	s := newTestSession(t)
+	s.Store = store
+	var err error
+	if s.RunID, err = store.CreateRun(s); err != nil {
+		t.Fatal(err)
+	}
+	severities := []string{matching.SeverityHigh, matching.SeverityLow, matching.SeverityCritical, matching.SeverityMedium,
+		matching.SeverityHigh}
+	for i, fingerprint := range []string{"a", "b", "c", "d", "e"} {
+		s.AddFinding(testFinding(fingerprint, severities[i]))
+	}
+	// a stored run served with thresholds holds findings below them
+	*s.Options.MinSeverity = matching.SeverityHigh
+
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []string
+	}{
+		{"all", 0, -1, []string{"a", "c", "e"}},
+		{"first page", 0, 2, []string{"a", "c"}},
+		{"last page", 2, 2, []string{"e"}},
+		{"past the end", 3, 2, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			findings, total, err := s.QueryFindingPage(test.offset, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 3 {
+				t.Errorf("total = %d, want 3", total)
+			}
+			if got := fingerprints(findings); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("fingerprints = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSaveStoredSession(t *testing.T) {
+	store := openTestStore(t)
+	s := newTestSession(t)
+	s.Store = store
+	var err error
+	if s.RunID, err = store.CreateRun(s); err != nil {
+		t.Fatal(err)
+	}
+	s.AddFinding(testFinding("a", matching.SeverityHigh))
+	s.AddFinding(testFinding("b", matching.SeverityLow))
+	s.AddSuppressedFinding(&matching.Finding{Fingerprint: "c", Suppression: &matching.Suppression{Line: 3}})
+	if err := s.SetTriage("b", &matching.Triage{Status: matching.TriageRevoked}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Write(&buf, "", SessionFileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var saved Session
+	if _, err := saved.Read(&buf, SessionFileOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fingerprints(saved.Findings); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("saved findings = %q, want [a b]", got)
+	}
+	if got := fingerprints(saved.Suppressed); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("saved suppressed findings = %q, want [c]", got)
+	}
+	if triage := saved.Findings[1].Triage; triage == nil || triage.Status != matching.TriageRevoked {
+		t.Errorf("saved triage of b = %v, want %s", triage, matching.TriageRevoked)
+	}
+}
+
+func TestLoadSessionFilesIntoStore(t *testing.T) {
+	dir := t.TempDir()
+	first, second := testSessionFileSession(), testSessionFileSession()
+	second.Findings = append(second.Findings, testFinding("fp2", matching.SeverityLow))
+	second.Suppressed = []*matching.Finding{testFinding("fp3", matching.SeverityLow)}
+	var locations []string
+	for i, s := range []*Session{first, second} {
+		location := filepath.Join(dir, []string{"first.json", "second.json.gz"}[i])
+		if err := s.SaveToFile(location, SessionFileOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		locations = append(locations, location)
+	}
+
+	tests := []struct {
+		name           string
+		locations      []string
+		wantFindings   []string
+		wantSuppressed []string
+	}{
+		{"one file", locations[1:], []string{"fp1", "fp2"}, []string{"fp3"}},
+		{"merged files", locations, []string{"fp1", "fp2"}, []string{"fp3"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := openTestStore(t)
+			s, err := LoadSessionFiles(test.locations, SessionFileOptions{}, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Store != store || len(s.Findings) != 0 || len(s.Suppressed) != 0 {
+				t.Fatalf("loaded %d findings and %d suppressed findings into memory, want them in the store", len(s.Findings), len(s.Suppressed))
+			}
+			findings, err := store.Findings(s.RunID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			suppressed, err := store.SuppressedFindings(s.RunID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fingerprints(findings); !reflect.DeepEqual(got, test.wantFindings) {
+				t.Errorf("stored findings = %q, want %q", got, test.wantFindings)
+			}
+			if got := fingerprints(suppressed); !reflect.DeepEqual(got, test.wantSuppressed) {
+				t.Errorf("stored suppressed findings = %q, want %q", got, test.wantSuppressed)
+			}
+			if len(test.locations) > 1 && (s.Stats.Findings != len(test.wantFindings) || s.Stats.Suppressed != len(test.wantSuppressed)) {
+				t.Errorf("stats count %d findings and %d suppressed, want %d and %d", s.Stats.Findings, s.Stats.Suppressed,
+					len(test.wantFindings), len(test.wantSuppressed))
+			}
+		})
+	}
+
+	store := openTestStore(t)
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte(`{"SchemaVersion":1,"Findings":[{"ID":"f1"},`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSessionFiles([]string{locations[0], corrupt}, SessionFileOptions{}, store); err == nil {
+		t.Fatal("loading a corrupt file succeeded")
+	}
+	if runs, err := store.Runs(); err != nil || len(runs) != 0 {
+		t.Errorf("runs after a failed load = %v, %v, want none", runs, err)
+	}
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gitrob/matching"
+)
+
+// TriageFileName is the file that triage is kept in without -store, next to
+// the -save file or the first -load file, so that later scans saved or
+// loaded there pick it up.
+const TriageFileName = "gitrob-triage.json"
+
+// TriageFile returns the location of the triage file, or "" when neither
+// -save nor -load is given.
+func (o *Options) TriageFile() string {
+	switch {
+	case *o.Save != "":
+		return filepath.Join(filepath.Dir(*o.Save), TriageFileName)
+	case len(o.Load) > 0:
+		return filepath.Join(filepath.Dir(o.Load[0]), TriageFileName)
+	}
+	return ""
+}
+
+// loadTriageFile reads the triage of a triage file, which is empty when the
+// file doesn't exist yet.
+func loadTriageFile(location string) (map[string]*matching.Triage, error) {
+	triage := make(map[string]*matching.Triage)
+	data, err := ioutil.ReadFile(location)
+	if os.IsNotExist(err) {
+		return triage, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &triage); err != nil {
+		return nil, err
+	}
+	return triage, nil
+}
+
+// saveTriageFile writes the triage to location, readable by the owner only.
+func saveTriageFile(location string, triage map[string]*matching.Triage) error {
+	data, err := json.MarshalIndent(triage, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOwnerOnly(location, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
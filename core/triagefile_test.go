@@ -0,0 +1,72 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitrob/matching"
+)
+
+func TestTriageFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"save", []string{"-save", filepath.Join(dir, "scans", "output.json.gz")}, filepath.Join(dir, "scans", TriageFileName)},
+		{"load", []string{"-load", filepath.Join(dir, "a.json"), "-load", filepath.Join(dir, "b", "b.json")}, filepath.Join(dir, TriageFileName)},
+		{"neither", nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestSession(t, test.args...)
+			if got := s.Options.TriageFile(); got != test.want {
+				t.Errorf("TriageFile() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTriageFilePersistence(t *testing.T) {
+	save := filepath.Join(t.TempDir(), "output.json")
+	older, newer := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	err := saveTriageFile(filepath.Join(filepath.Dir(save), TriageFileName), map[string]*matching.Triage{
+		"kept":     {Status: matching.TriageConfirmed, UpdatedAt: newer},
+		"replaced": {Status: matching.TriageConfirmed, UpdatedAt: older},
+		"removed":  {Status: matching.TriageConfirmed, UpdatedAt: older},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSession(t, "-save", save)
+	s.Triage = map[string]*matching.Triage{
+		"kept":     {Status: matching.TriageFalsePositive, UpdatedAt: older},
+		"replaced": {Status: matching.TriageFalsePositive, UpdatedAt: newer},
+	}
+	s.InitStore()
+	if err := s.SetTriage("added", &matching.Triage{Status: matching.TriageRevoked}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTriage("removed", &matching.Triage{}); err != nil {
+		t.Fatal(err)
+	}
+
+	later := newTestSession(t, "-save", save)
+	later.InitStore()
+	want := map[string]string{
+		"kept":     matching.TriageConfirmed,
+		"replaced": matching.TriageFalsePositive,
+		"added":    matching.TriageRevoked,
+	}
+	if len(later.Triage) != len(want) {
+		t.Errorf("later scan loaded triage of %d fingerprints, want %d", len(later.Triage), len(want))
+	}
+	for fingerprint, status := range want {
+		if triage := later.Triage[fingerprint]; triage == nil || triage.Status != status {
+			t.Errorf("triage of %s = %v, want %s", fingerprint, triage, status)
+		}
+	}
+}
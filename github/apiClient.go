@@ -32,6 +32,7 @@ func (c Client) GetUserOrOrganization(login string) (*common.Owner, error) {
 		return nil, err
 	}
 	return &common.Owner{
+		Provider:  github.String(common.ProviderGitHub),
 		Login:     user.Login,
 		ID:        user.ID,
 		Type:      user.Type,
@@ -61,6 +62,7 @@ func (c Client) GetRepositoriesFromOwner(target *common.Owner) ([]*common.Reposi
 		for _, repo := range repos {
 			if !*repo.Fork {
 				r := common.Repository{
+					Provider:      github.String(common.ProviderGitHub),
 					Owner:         repo.Owner.Login,
 					ID:            repo.ID,
 					Name:          repo.Name,
@@ -93,7 +95,12 @@ func (c Client) GetOrganizationMembers(target *common.Owner) ([]*common.Owner, e
 			return allMembers, err
 		}
 		for _, member := range members {
-			allMembers = append(allMembers, &common.Owner{Login: member.Login, ID: member.ID, Type: member.Type})
+			allMembers = append(allMembers, &common.Owner{
+				Provider: github.String(common.ProviderGitHub),
+				Login:    member.Login,
+				ID:       member.ID,
+				Type:     member.Type,
+			})
 		}
 		if resp.NextPage == 0 {
 			break
@@ -39,6 +39,7 @@ func (c Client) GetUserOrOrganization(login string) (*common.Owner, error) {
 		}
 		id := int64(user.ID)
 		return &common.Owner{
+			Provider:  gitlab.String(common.ProviderGitLab),
 			Login:     gitlab.String(user.Username),
 			ID:        &id,
 			Type:      gitlab.String(common.TargetTypeUser),
@@ -55,6 +56,7 @@ func (c Client) GetUserOrOrganization(login string) (*common.Owner, error) {
 
 	id := int64(org.ID)
 	return &common.Owner{
+		Provider:  gitlab.String(common.ProviderGitLab),
 		Login:     gitlab.String(org.Name),
 		ID:        &id,
 		Type:      gitlab.String(common.TargetTypeOrganization),
@@ -82,9 +84,10 @@ func (c Client) GetOrganizationMembers(target *common.Owner) ([]*common.Owner, e
 			id := int64(member.ID)
 			allMembers = append(allMembers,
 				&common.Owner{
-					Login: gitlab.String(member.Username),
-					ID:    &id,
-					Type:  gitlab.String(common.TargetTypeUser)})
+					Provider: gitlab.String(common.ProviderGitLab),
+					Login:    gitlab.String(member.Username),
+					ID:       &id,
+					Type:     gitlab.String(common.TargetTypeUser)})
 		}
 		if resp.NextPage == 0 {
 			break
@@ -171,6 +174,7 @@ func (c Client) getProjects(getter projectsGetter, increasePage func(int)) ([]*c
 			if project.ForkedFromProject == nil {
 				id := int64(project.ID)
 				p := common.Repository{
+					Provider:      gitlab.String(common.ProviderGitLab),
 					Owner:         gitlab.String(project.Namespace.FullPath),
 					ID:            &id,
 					Name:          gitlab.String(project.Name),
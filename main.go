@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"gitrob/common"
@@ -15,6 +16,16 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := core.Commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	if sess, err = core.NewSession(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -22,13 +33,20 @@ func main() {
 
 	sess.Out.Infof("%s\n\n", common.ASCIIBanner)
 	sess.Out.Importantf("%s v%s started at %s\n", common.Name, common.Version, sess.Stats.StartedAt.Format(time.RFC3339))
-	sess.Out.Importantf("Loaded %d file signatures and %d content signatures.\n",
-		len(sess.Signatures.FileSignatures), len(sess.Signatures.ContentSignatures))
+	sess.Out.Importantf("Loaded %d file, %d content, %d key/value and %d composite signatures.\n",
+		len(sess.Signatures.FileSignatures), len(sess.Signatures.ContentSignatures), len(sess.Signatures.KeyValueSignatures),
+		len(sess.Signatures.CompositeSignatures))
 	sess.Out.Importantf("Web interface available at http://%s:%d\n", *sess.Options.BindAddress, *sess.Options.Port)
 
-	if sess.Stats.Status == "finished" {
-		sess.Out.Importantf("Loaded session file: %s\n", *sess.Options.Load)
+	if *sess.Options.Run != 0 {
+		sess.Out.Importantf("Loaded run %d from %s\n", sess.RunID, *sess.Options.Store)
+	} else if sess.Stats.Status == "finished" {
+		sess.Out.Importantf("Loaded session %s: %s\n", common.Pluralize(len(sess.Options.Load), "file", "files"),
+			strings.Join(sess.Options.Load, ", "))
 	} else {
+		if sess.Store != nil {
+			sess.Out.Importantf("Writing run %d to %s\n", sess.RunID, *sess.Options.Store)
+		}
 		if len(sess.Options.Logins) == 0 {
 			host := func() string {
 				if sess.IsGithubSession {
@@ -45,7 +63,7 @@ func main() {
 		sess.Finish()
 
 		if *sess.Options.Save != "" {
-			err := sess.SaveToFile(*sess.Options.Save)
+			err := sess.SaveToFile(*sess.Options.Save, sess.Options.SessionFile())
 			if err != nil {
 				sess.Out.Errorf("Errorf saving session to %s: %s\n", *sess.Options.Save, err)
 			}
@@ -53,6 +71,30 @@ func main() {
 		}
 	}
 
+	if *sess.Options.Report != "" {
+		if err := sess.SaveReport(*sess.Options.Report); err != nil {
+			sess.Out.Errorf("Errorf writing report to %s: %s\n", *sess.Options.Report, err)
+		} else {
+			sess.Out.Importantf("Wrote report to: %s\n\n", *sess.Options.Report)
+		}
+	}
+
+	if *sess.Options.GitLabReport != "" {
+		if err := sess.SaveGitLabReport(*sess.Options.GitLabReport); err != nil {
+			sess.Out.Errorf("Errorf writing GitLab report to %s: %s\n", *sess.Options.GitLabReport, err)
+		} else {
+			sess.Out.Importantf("Wrote GitLab report to: %s\n\n", *sess.Options.GitLabReport)
+		}
+	}
+
+	if len(sess.Options.Exports) > 0 {
+		if err := sess.SaveRecords(sess.Options.Exports); err != nil {
+			sess.Out.Errorf("Errorf exporting records: %s\n", err)
+		} else {
+			sess.Out.Importantf("Exported records to: %s\n\n", sess.Options.Exports.String())
+		}
+	}
+
 	core.PrintSessionStats(sess)
 	if !sess.IsGithubSession {
 		sess.Out.Errorf("%s", common.GitLabTanuki)
@@ -0,0 +1,210 @@
+package matching
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+const ArchiveSeparator = "!/"
+
+type ArchiveLimits struct {
+	MaxSize  int64
+	MaxDepth int
+}
+
+type ArchiveMember struct {
+	Path    string
+	Content []byte
+}
+
+type archiveFormat int
+
+const (
+	archiveNone archiveFormat = iota
+	archiveZip
+	archiveTar
+	archiveTarGzip
+	archiveTarBzip2
+	archiveGzip
+	archiveBzip2
+)
+
+var zipExtensions = []string{".zip", ".jar", ".war", ".ear", ".apk", ".aar", ".nupkg", ".whl"}
+
+func getArchiveFormat(name string) archiveFormat {
+	name = strings.ToLower(name)
+	for _, ext := range zipExtensions {
+		if strings.HasSuffix(name, ext) {
+			return archiveZip
+		}
+	}
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGzip
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"):
+		return archiveTarBzip2
+	case strings.HasSuffix(name, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(name, ".gz"):
+		return archiveGzip
+	case strings.HasSuffix(name, ".bz2"):
+		return archiveBzip2
+	}
+	return archiveNone
+}
+
+func IsArchive(name string) bool {
+	return getArchiveFormat(name) != archiveNone
+}
+
+// SplitArchivePath returns the path of the outermost archive for a member path
+// such as "dist/app.war!/WEB-INF/web.xml", or the path itself for regular files.
+func SplitArchivePath(memberPath string) (string, string) {
+	i := strings.Index(memberPath, ArchiveSeparator)
+	if i < 0 {
+		return memberPath, ""
+	}
+	return memberPath[:i], memberPath[i+len(ArchiveSeparator):]
+}
+
+type archiveExpander struct {
+	limits    ArchiveLimits
+	remaining int64
+	members   []ArchiveMember
+	skipped   []error
+}
+
+// errArchiveLimit stops the expansion of an archive, where other errors only
+// skip the member they occur in.
+type errArchiveLimit struct {
+	error
+}
+
+// ExpandArchive recursively unpacks the archive stored at name and returns all
+// of its regular file members. Nested archives are expanded up to MaxDepth
+// levels and no more than MaxSize uncompressed bytes are read in total. A
+// member that can't be read or unpacked is skipped, and the reason returned
+// in skipped, while the rest of the archive is still expanded.
+func ExpandArchive(name string, data []byte, limits ArchiveLimits) (members []ArchiveMember, skipped []error, err error) {
+	e := &archiveExpander{limits: limits, remaining: limits.MaxSize}
+	err = e.expand(name, data, 1)
+	return e.members, e.skipped, err
+}
+
+// skip records the error of a member and reports whether expansion goes on.
+func (e *archiveExpander) skip(memberPath string, err error) error {
+	if _, ok := err.(errArchiveLimit); ok {
+		return err
+	}
+	e.skipped = append(e.skipped, fmt.Errorf("%s: %s", memberPath, err))
+	return nil
+}
+
+func (e *archiveExpander) expand(name string, data []byte, depth int) error {
+	switch getArchiveFormat(name) {
+	case archiveZip:
+		return e.expandZip(name, data, depth)
+	case archiveTar:
+		return e.expandTar(name, bytes.NewReader(data), depth)
+	case archiveTarGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		return e.expandTar(name, r, depth)
+	case archiveTarBzip2:
+		return e.expandTar(name, bzip2.NewReader(bytes.NewReader(data)), depth)
+	case archiveGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		return e.add(name, strings.TrimSuffix(path.Base(name), path.Ext(name)), r, depth)
+	case archiveBzip2:
+		return e.add(name, strings.TrimSuffix(path.Base(name), path.Ext(name)), bzip2.NewReader(bytes.NewReader(data)), depth)
+	case archiveNone:
+	}
+	return fmt.Errorf("unsupported archive format: %s", name)
+}
+
+func (e *archiveExpander) expandZip(name string, data []byte, depth int) error {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			if err := e.skip(memberPath(name, f.Name), err); err != nil {
+				return err
+			}
+			continue
+		}
+		err = e.add(name, f.Name, rc, depth)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *archiveExpander) expandTar(name string, r io.Reader, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := e.add(name, header.Name, tr, depth); err != nil {
+			return err
+		}
+	}
+}
+
+// add reads a member and expands it when it is an archive itself. Only
+// exceeding the size limit is returned as an error, other errors skip the
+// member.
+func (e *archiveExpander) add(archiveName, memberName string, r io.Reader, depth int) error {
+	if e.remaining <= 0 {
+		return errArchiveLimit{fmt.Errorf("archive size limit of %d bytes exceeded: %s", e.limits.MaxSize, archiveName)}
+	}
+	path := memberPath(archiveName, memberName)
+	content, err := ioutil.ReadAll(io.LimitReader(r, e.remaining+1))
+	e.remaining -= int64(len(content))
+	if e.remaining < 0 {
+		return errArchiveLimit{fmt.Errorf("archive size limit of %d bytes exceeded: %s", e.limits.MaxSize, archiveName)}
+	}
+	if err != nil {
+		return e.skip(path, err)
+	}
+
+	e.members = append(e.members, ArchiveMember{Path: path, Content: content})
+	if depth < e.limits.MaxDepth && IsArchive(memberName) {
+		if err := e.expand(path, content, depth+1); err != nil {
+			return e.skip(path, err)
+		}
+	}
+	return nil
+}
+
+func memberPath(archiveName, memberName string) string {
+	return archiveName + ArchiveSeparator + strings.TrimPrefix(memberName, "/")
+}
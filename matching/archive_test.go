@@ -0,0 +1,197 @@
+package matching
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type testMember struct {
+	name    string
+	content []byte
+	method  uint16
+}
+
+func zipArchive(t *testing.T, members ...testMember) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	// a method the reader can't decompress
+	w.RegisterCompressor(99, func(out io.Writer) (io.WriteCloser, error) {
+		return nopCloser{out}, nil
+	})
+	for _, member := range members {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: member.name, Method: member.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(member.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func tarArchive(t *testing.T, members ...testMember) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := tar.NewWriter(&b)
+	for _, member := range members {
+		header := &tar.Header{Name: member.name, Mode: 0600, Size: int64(len(member.content)), Typeflag: tar.TypeReg}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(member.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestExpandArchive(t *testing.T) {
+	limits := ArchiveLimits{MaxSize: 1 << 20, MaxDepth: 2}
+	nested := zipArchive(t, testMember{name: "config/secret.properties", content: []byte("password=hunter2")})
+	tests := []struct {
+		name        string
+		archive     string
+		data        []byte
+		limits      ArchiveLimits
+		wantPaths   []string
+		wantSkipped int
+		wantErr     bool
+	}{
+		{
+			name:    "zip with a nested jar",
+			archive: "app.zip",
+			data: zipArchive(t,
+				testMember{name: "README", content: []byte("hello")},
+				testMember{name: "lib/inner.jar", content: nested}),
+			limits:    limits,
+			wantPaths: []string{"app.zip!/README", "app.zip!/lib/inner.jar", "app.zip!/lib/inner.jar!/config/secret.properties"},
+		},
+		{
+			name:      "nested archives beyond the depth limit aren't expanded",
+			archive:   "app.zip",
+			data:      zipArchive(t, testMember{name: "lib/inner.jar", content: nested}),
+			limits:    ArchiveLimits{MaxSize: 1 << 20, MaxDepth: 1},
+			wantPaths: []string{"app.zip!/lib/inner.jar"},
+		},
+		{
+			name:    "corrupt nested archives are skipped",
+			archive: "app.zip",
+			data: zipArchive(t,
+				testMember{name: "broken.jar", content: []byte("not a zip")},
+				testMember{name: "notes.gz", content: []byte("plain text")},
+				testMember{name: "after.txt", content: []byte("still scanned")}),
+			limits:      limits,
+			wantPaths:   []string{"app.zip!/broken.jar", "app.zip!/notes.gz", "app.zip!/after.txt"},
+			wantSkipped: 2,
+		},
+		{
+			name:    "members with unsupported compression are skipped",
+			archive: "app.zip",
+			data: zipArchive(t,
+				testMember{name: "odd.bin", content: []byte("data"), method: 99},
+				testMember{name: "after.txt", content: []byte("still scanned")}),
+			limits:      limits,
+			wantPaths:   []string{"app.zip!/after.txt"},
+			wantSkipped: 1,
+		},
+		{
+			name:      "tar.gz",
+			archive:   "backup.tar.gz",
+			data:      gzipData(t, tarArchive(t, testMember{name: "/etc/shadow", content: []byte("root:x")})),
+			limits:    limits,
+			wantPaths: []string{"backup.tar.gz!/etc/shadow"},
+		},
+		{
+			name:      "gzip",
+			archive:   "dump.sql.gz",
+			data:      gzipData(t, []byte("INSERT INTO users")),
+			limits:    limits,
+			wantPaths: []string{"dump.sql.gz!/dump.sql"},
+		},
+		{
+			name:    "size limit stops expansion",
+			archive: "app.zip",
+			data: zipArchive(t,
+				testMember{name: "a.txt", content: bytes.Repeat([]byte("a"), 10)},
+				testMember{name: "b.txt", content: bytes.Repeat([]byte("b"), 10)}),
+			limits:    ArchiveLimits{MaxSize: 15, MaxDepth: 2},
+			wantPaths: []string{"app.zip!/a.txt"},
+			wantErr:   true,
+		},
+		{
+			name:    "corrupt outer archive",
+			archive: "app.zip",
+			data:    []byte("not a zip"),
+			limits:  limits,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			members, skipped, err := ExpandArchive(test.archive, test.data, test.limits)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, want error %v", err, test.wantErr)
+			}
+			var paths []string
+			for _, member := range members {
+				paths = append(paths, member.Path)
+			}
+			if !reflect.DeepEqual(paths, test.wantPaths) {
+				t.Errorf("paths = %q, want %q", paths, test.wantPaths)
+			}
+			if len(skipped) != test.wantSkipped {
+				t.Errorf("skipped = %v, want %d", skipped, test.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestSplitArchivePath(t *testing.T) {
+	tests := []struct {
+		path, archive, member string
+	}{
+		{"dist/app.war!/WEB-INF/web.xml", "dist/app.war", "WEB-INF/web.xml"},
+		{"a.zip!/b.jar!/c.txt", "a.zip", "b.jar!/c.txt"},
+		{"config.yml", "config.yml", ""},
+	}
+	for _, test := range tests {
+		archive, member := SplitArchivePath(test.path)
+		if archive != test.archive || member != test.member {
+			t.Errorf("SplitArchivePath(%q) = %q, %q, want %q, %q", test.path, archive, member, test.archive, test.member)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package matching
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Condition is a node of the condition tree of a composite signature. Exactly
+// one of its fields is set: All, Any and Not combine other conditions, Path,
+// Filename, Extension and Content are regular expressions, and Near requires
+// several content patterns to match close to each other.
+type Condition struct {
+	All       []Condition `json:",omitempty"`
+	Any       []Condition `json:",omitempty"`
+	Not       *Condition  `json:",omitempty"`
+	Path      string      `json:",omitempty"`
+	Filename  string      `json:",omitempty"`
+	Extension string      `json:",omitempty"`
+	Content   string      `json:",omitempty"`
+	Near      *Proximity  `json:",omitempty"`
+}
+
+// Proximity matches when every pattern matches within a window of Lines lines.
+type Proximity struct {
+	Patterns []string
+	Lines    int
+}
+
+type CompositeExample struct {
+	Path    string
+	Content string `json:",omitempty"`
+}
+
+type CompositeSignature struct {
+	ID              string
+	Severity        string
+	Confidence      string
+	Condition       Condition
+	Description     string
+	Comment         string
+	Examples        []CompositeExample `json:",omitempty"`
+	Counterexamples []CompositeExample `json:",omitempty"`
+}
+
+// Validate checks that every node of the condition tree sets exactly one field
+// and that all patterns compile.
+func (c Condition) Validate() error {
+	set := 0
+	for _, isSet := range []bool{c.All != nil, c.Any != nil, c.Not != nil, c.Path != "", c.Filename != "",
+		c.Extension != "", c.Content != "", c.Near != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("a condition must have exactly one of All, Any, Not, Path, Filename, Extension, Content or Near")
+	}
+	for _, pattern := range []string{c.Path, c.Filename, c.Extension, c.Content} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return err
+		}
+	}
+	for _, sub := range append(append([]Condition{}, c.All...), c.Any...) {
+		if err := sub.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		return c.Not.Validate()
+	}
+	if c.Near != nil {
+		if len(c.Near.Patterns) < 2 || c.Near.Lines < 0 {
+			return errors.New("a Near condition needs at least two patterns and a non-negative number of lines")
+		}
+		for _, pattern := range c.Near.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UsesContent reports whether evaluating the condition may need the content of
+// the file.
+func (c Condition) UsesContent() bool {
+	if c.Content != "" || c.Near != nil {
+		return true
+	}
+	if c.Not != nil && c.Not.UsesContent() {
+		return true
+	}
+	for _, sub := range append(append([]Condition{}, c.All...), c.Any...) {
+		if sub.UsesContent() {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate matches the condition against the target. The content is only read
+// when a content condition is reached, and the conditions of All and Any that
+// don't need it are evaluated first, so conditions on the path can rule out a
+// file without loading it.
+func (c Condition) Evaluate(target MatchTarget, content func() (string, error)) (bool, error) {
+	switch {
+	case c.All != nil:
+		for _, sub := range contentLast(c.All) {
+			matched, err := sub.Evaluate(target, content)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	case c.Any != nil:
+		for _, sub := range contentLast(c.Any) {
+			matched, err := sub.Evaluate(target, content)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	case c.Not != nil:
+		matched, err := c.Not.Evaluate(target, content)
+		return !matched, err
+	case c.Path != "":
+		return matchPattern(c.Path, target.Path)
+	case c.Filename != "":
+		return matchPattern(c.Filename, target.Filename)
+	case c.Extension != "":
+		return matchPattern(c.Extension, target.Extension)
+	case c.Content != "":
+		text, err := content()
+		if err != nil {
+			return false, err
+		}
+		return matchPattern(c.Content, text)
+	case c.Near != nil:
+		text, err := content()
+		if err != nil {
+			return false, err
+		}
+		return c.Near.Match(text)
+	default:
+		return false, fmt.Errorf("empty condition")
+	}
+}
+
+// contentLast orders conditions that need the content after those that don't.
+func contentLast(conditions []Condition) []Condition {
+	ordered := make([]Condition, 0, len(conditions))
+	for _, sub := range conditions {
+		if !sub.UsesContent() {
+			ordered = append(ordered, sub)
+		}
+	}
+	for _, sub := range conditions {
+		if sub.UsesContent() {
+			ordered = append(ordered, sub)
+		}
+	}
+	return ordered
+}
+
+// Locate returns the locations of the Content and Near patterns of the
+// condition in text, ordered by offset. Patterns under Not are left out, since
+// what they match isn't what the signature found.
+func (c Condition) Locate(text string) ([][]int, error) {
+	var locations [][]int
+	if err := c.locate(text, &locations); err != nil {
+		return nil, err
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i][0] < locations[j][0]
+	})
+	return locations, nil
+}
+
+func (c Condition) locate(text string, locations *[][]int) error {
+	var patterns []string
+	switch {
+	case c.Content != "":
+		patterns = []string{c.Content}
+	case c.Near != nil:
+		patterns = c.Near.Patterns
+	}
+	for _, pattern := range patterns {
+		r, err := compilePattern(pattern)
+		if err != nil {
+			return err
+		}
+		*locations = append(*locations, r.FindAllStringIndex(text, -1)...)
+	}
+	for _, sub := range append(append([]Condition{}, c.All...), c.Any...) {
+		if err := sub.locate(text, locations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type lineMatch struct {
+	line    int
+	pattern int
+}
+
+// Match reports whether all patterns match somewhere within a window of
+// p.Lines lines of text.
+func (p *Proximity) Match(text string) (bool, error) {
+	var matches []lineMatch
+	for i, pattern := range p.Patterns {
+		r, err := compilePattern(pattern)
+		if err != nil {
+			return false, err
+		}
+		found := r.FindAllStringIndex(text, -1)
+		if found == nil {
+			return false, nil
+		}
+		for _, loc := range found {
+			matches = append(matches, lineMatch{line: strings.Count(text[:loc[0]], "\n"), pattern: i})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].line < matches[j].line
+	})
+
+	counts := make([]int, len(p.Patterns))
+	covered := 0
+	start := 0
+	for _, m := range matches {
+		if counts[m.pattern] == 0 {
+			covered++
+		}
+		counts[m.pattern]++
+		for matches[start].line < m.line-p.Lines {
+			counts[matches[start].pattern]--
+			if counts[matches[start].pattern] == 0 {
+				covered--
+			}
+			start++
+		}
+		if covered == len(p.Patterns) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c CompositeSignature) Match(target MatchTarget, content func() (string, error)) (bool, error) {
+	return c.Condition.Evaluate(target, content)
+}
+
+func (c CompositeSignature) GetID() string {
+	return c.ID
+}
+
+func (c CompositeSignature) GetDescription() string {
+	return c.Description
+}
+
+func (c CompositeSignature) GetComment() string {
+	return c.Comment
+}
+
+func (c CompositeSignature) GetSeverity() string {
+	return c.Severity
+}
+
+func (c CompositeSignature) GetConfidence() string {
+	return c.Confidence
+}
@@ -0,0 +1,170 @@
+package matching
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	target := MatchTarget{Path: "deploy/docker-compose.yml", Filename: "docker-compose.yml", Extension: ".yml"}
+	content := "services:\n  db:\n    environment:\n      POSTGRES_PASSWORD: hunter22\n"
+	tests := []struct {
+		name      string
+		condition Condition
+		want      bool
+		wantRead  bool
+		wantErr   bool
+	}{
+		{name: "path", condition: Condition{Path: "^deploy/"}, want: true},
+		{name: "filename", condition: Condition{Filename: `^docker-compose.*\.ya?ml$`}, want: true},
+		{name: "extension", condition: Condition{Extension: `^\.json$`}},
+		{name: "content", condition: Condition{Content: "POSTGRES_PASSWORD"}, want: true, wantRead: true},
+		{name: "not", condition: Condition{Not: &Condition{Content: "MYSQL_PASSWORD"}}, want: true, wantRead: true},
+		{
+			name:      "all",
+			condition: Condition{All: []Condition{{Filename: "docker-compose"}, {Content: "PASSWORD: [^$]"}}},
+			want:      true,
+			wantRead:  true,
+		},
+		{
+			name:      "all ruled out by the path before the content",
+			condition: Condition{All: []Condition{{Content: "PASSWORD"}, {Extension: `^\.env$`}}},
+		},
+		{
+			name:      "any matched by the path before the content",
+			condition: Condition{Any: []Condition{{Near: &Proximity{Patterns: []string{"db", "PASSWORD"}, Lines: 3}}, {Path: "compose"}}},
+			want:      true,
+		},
+		{
+			name:      "any",
+			condition: Condition{Any: []Condition{{Path: "^src/"}, {Content: "hunter2"}}},
+			want:      true,
+			wantRead:  true,
+		},
+		{name: "near", condition: Condition{Near: &Proximity{Patterns: []string{"db:", "PASSWORD"}, Lines: 2}}, want: true, wantRead: true},
+		{name: "empty", condition: Condition{}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			read := false
+			got, err := test.condition.Evaluate(target, func() (string, error) {
+				read = true
+				return content, nil
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want an error: %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("Evaluate = %v, want %v", got, test.want)
+			}
+			if read != test.wantRead {
+				t.Errorf("content read: %v, want %v", read, test.wantRead)
+			}
+		})
+	}
+
+	failing := func() (string, error) { return "", errors.New("read failed") }
+	if _, err := (Condition{Content: "x"}).Evaluate(target, failing); err == nil {
+		t.Error("Evaluate ignored an error reading the content")
+	}
+}
+
+func TestProximityMatch(t *testing.T) {
+	text := "user = admin\n\n\npassword = hunter2\nhost = db\n"
+	tests := []struct {
+		name      string
+		proximity Proximity
+		want      bool
+	}{
+		{name: "within the window", proximity: Proximity{Patterns: []string{"user", "password"}, Lines: 3}, want: true},
+		{name: "outside the window", proximity: Proximity{Patterns: []string{"user", "password"}, Lines: 2}},
+		{name: "same line", proximity: Proximity{Patterns: []string{"password", "hunter2"}}, want: true},
+		{name: "adjacent lines with no window", proximity: Proximity{Patterns: []string{"password", "host"}}},
+		{name: "pattern order doesn't matter", proximity: Proximity{Patterns: []string{"host", "password"}, Lines: 1}, want: true},
+		{name: "three patterns", proximity: Proximity{Patterns: []string{"user", "password", "host"}, Lines: 4}, want: true},
+		{name: "three patterns spread too far", proximity: Proximity{Patterns: []string{"user", "password", "host"}, Lines: 3}},
+		{name: "missing pattern", proximity: Proximity{Patterns: []string{"user", "token"}, Lines: 10}},
+		{
+			name:      "later occurrence in the window",
+			proximity: Proximity{Patterns: []string{"=", "db"}},
+			want:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.proximity.Match(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("Match = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLocate(t *testing.T) {
+	content := "user = admin\npassword = hunter2\n"
+	condition := Condition{All: []Condition{
+		{Filename: `\.env$`},
+		{Near: &Proximity{Patterns: []string{"password", "user"}, Lines: 1}},
+		{Not: &Condition{Content: "admin"}},
+	}}
+	locations, err := condition.Locate(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{0, 4}, {13, 21}}; !reflect.DeepEqual(locations, want) {
+		t.Errorf("Locate = %v, want %v", locations, want)
+	}
+}
+
+func TestCompositeSignatureMatcher(t *testing.T) {
+	content := "# gitrob:allow[db-password]\npassword = hunter2\n"
+	signatures := &Signatures{CompositeSignatures: []CompositeSignature{
+		{ID: "env-file", Condition: Condition{Filename: `^\.env$`}},
+		{ID: "db-password", Condition: Condition{All: []Condition{{Filename: `^\.env$`}, {Content: "password = .+"}}}},
+	}}
+	file := NewFile(MatchTarget{Path: ".env", Filename: ".env"}, func() (string, error) { return content, nil }, nil, 0)
+	matches, err := compositeSignatureMatcher{signatures}.Match(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(matches))
+	}
+	if matches[0].FileSignature.GetID() != "env-file" || matches[0].Locations != nil {
+		t.Errorf("first match = %+v, want env-file as a file signature", matches[0])
+	}
+	match := matches[1]
+	if match.ContentSignature.GetID() != "db-password" || !reflect.DeepEqual(match.Locations, [][]int{{28, 46}}) {
+		t.Fatalf("second match = %+v, want db-password at 28-46", match)
+	}
+	if _, s := FirstUnsuppressed(match.Content, match.Locations, "db-password"); s == nil {
+		t.Error("the annotation above the match doesn't suppress it")
+	}
+}
+
+func TestLoadCompositeSignaturesInFileMode(t *testing.T) {
+	DefaultSignatures = os.DirFS("..")
+	defer func() { DefaultSignatures = os.DirFS(".") }()
+	s := &Signatures{CompositeSignatures: []CompositeSignature{
+		{ID: "env-file", Condition: Condition{Filename: `^\.env$`}},
+		{ID: "db-password", Condition: Condition{All: []Condition{{Filename: `^\.env$`}, {Content: "password"}}}},
+	}}
+	if err := s.Load(ModeFileMatch, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	kept := false
+	for _, signature := range s.CompositeSignatures {
+		if signature.Condition.UsesContent() {
+			t.Errorf("mode 1 loaded %s, which reads content", signature.ID)
+		}
+		kept = kept || signature.ID == "env-file"
+	}
+	if !kept {
+		t.Error("mode 1 dropped env-file, which only looks at the path")
+	}
+}
@@ -0,0 +1,278 @@
+package matching
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type KeyValuePair struct {
+	Key   string
+	Value string
+}
+
+type configFormat int
+
+const (
+	configNone configFormat = iota
+	configEnv
+	configYAML
+	configJSON
+	configTOML
+	configINI
+	configProperties
+	configTerraform
+	configXML
+)
+
+var configExtensions = map[string]configFormat{
+	".env":        configEnv,
+	".yml":        configYAML,
+	".yaml":       configYAML,
+	".json":       configJSON,
+	".toml":       configTOML,
+	".ini":        configINI,
+	".cfg":        configINI,
+	".conf":       configINI,
+	".properties": configProperties,
+	".tf":         configTerraform,
+	".tfvars":     configTerraform,
+	".xml":        configXML,
+	".config":     configXML,
+}
+
+var (
+	assignmentRegex     = regexp.MustCompile(`^\s*(?:export\s+)?([A-Za-z0-9_.\-]+|"[^"]+"|'[^']+')\s*(=|:)\s*(.*?)\s*$`)
+	sectionRegex        = regexp.MustCompile(`^\s*\[+\s*([^\]]+?)\s*\]+\s*$`)
+	terraformBlockRegex = regexp.MustCompile(`^\s*([A-Za-z0-9_\-]+)((?:\s+"[^"]*")*)\s*\{\s*$`)
+)
+
+func getConfigFormat(filename string) configFormat {
+	filename = strings.ToLower(filename)
+	if filename == ".env" || strings.HasPrefix(filename, ".env.") {
+		return configEnv
+	}
+	return configExtensions[filepath.Ext(filename)]
+}
+
+func IsConfigFile(filename string) bool {
+	return getConfigFormat(filename) != configNone
+}
+
+// ExtractKeyValues parses content according to the configuration format implied
+// by filename and returns the key/value pairs it contains. Nested keys are
+// joined with dots. Structured formats that fail to parse, which is common for
+// partial content taken from a diff, fall back to line based extraction.
+func ExtractKeyValues(filename, content string) []KeyValuePair {
+	switch getConfigFormat(filename) {
+	case configEnv:
+		return extractAssignments(content, "=", false)
+	case configINI, configTOML:
+		return extractAssignments(content, "=:", true)
+	case configProperties:
+		return extractAssignments(content, "=:", false)
+	case configTerraform:
+		return extractTerraform(content)
+	case configYAML:
+		if pairs, err := extractYAML(content); err == nil {
+			return pairs
+		}
+		return extractAssignments(content, ":", false)
+	case configJSON:
+		if pairs, err := extractJSON(content); err == nil {
+			return pairs
+		}
+		return extractAssignments(strings.NewReplacer(`",`, `"`, `{`, ``, `}`, ``).Replace(content), ":", false)
+	case configXML:
+		if pairs, err := extractXML(content); err == nil {
+			return pairs
+		}
+		return nil
+	case configNone:
+	}
+	return nil
+}
+
+func extractAssignments(content, separators string, sections bool) []KeyValuePair {
+	var pairs []KeyValuePair
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(content)+1)
+	for scanner.Scan() {
+		line := strings.TrimLeft(scanner.Text(), "- \t")
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if sections {
+			if m := sectionRegex.FindStringSubmatch(line); m != nil {
+				section = m[1]
+				continue
+			}
+		}
+		m := assignmentRegex.FindStringSubmatch(line)
+		if m == nil || !strings.Contains(separators, m[2]) {
+			continue
+		}
+		key := unquote(m[1])
+		if section != "" {
+			key = section + "." + key
+		}
+		pairs = append(pairs, KeyValuePair{Key: key, Value: unquote(strings.TrimSuffix(m[3], ","))})
+	}
+	return pairs
+}
+
+func extractTerraform(content string) []KeyValuePair {
+	var pairs []KeyValuePair
+	var blocks []string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(content)+1)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := terraformBlockRegex.FindStringSubmatch(line); m != nil {
+			labels := strings.Fields(strings.ReplaceAll(m[2], `"`, ""))
+			blocks = append(blocks, strings.Join(append([]string{m[1]}, labels...), "."))
+			continue
+		}
+		if strings.HasPrefix(line, "}") {
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+			continue
+		}
+		m := assignmentRegex.FindStringSubmatch(line)
+		if m == nil || m[2] != "=" {
+			continue
+		}
+		key := unquote(m[1])
+		if len(blocks) > 0 {
+			// the value of `variable "db_password" { default = "..." }` belongs to the variable itself
+			if key == "default" || key == "value" {
+				key = strings.Join(blocks, ".")
+			} else {
+				key = strings.Join(blocks, ".") + "." + key
+			}
+		}
+		pairs = append(pairs, KeyValuePair{Key: key, Value: unquote(m[3])})
+	}
+	return pairs
+}
+
+func extractYAML(content string) ([]KeyValuePair, error) {
+	var pairs []KeyValuePair
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var document interface{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			return pairs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		flatten("", document, &pairs)
+	}
+}
+
+func extractJSON(content string) ([]KeyValuePair, error) {
+	var pairs []KeyValuePair
+	var document interface{}
+	if err := json.Unmarshal([]byte(content), &document); err != nil {
+		return nil, err
+	}
+	flatten("", document, &pairs)
+	return pairs, nil
+}
+
+func flatten(prefix string, value interface{}, pairs *[]KeyValuePair) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	// keys are flattened in order, so that the same file always gives the same
+	// pairs and findings
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			flatten(join(key), v[key], pairs)
+		}
+	case map[interface{}]interface{}:
+		children := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			children[fmt.Sprint(key)] = child
+		}
+		flatten(prefix, children, pairs)
+	case []interface{}:
+		for i, child := range v {
+			flatten(join(fmt.Sprint(i)), child, pairs)
+		}
+	case nil:
+		*pairs = append(*pairs, KeyValuePair{Key: prefix})
+	default:
+		*pairs = append(*pairs, KeyValuePair{Key: prefix, Value: fmt.Sprint(v)})
+	}
+}
+
+func extractXML(content string) ([]KeyValuePair, error) {
+	var pairs []KeyValuePair
+	var elements []string
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return pairs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			elements = append(elements, t.Name.Local)
+			path := strings.Join(elements, ".")
+			attributes := make(map[string]string)
+			for _, attr := range t.Attr {
+				attributes[strings.ToLower(attr.Name.Local)] = attr.Value
+				pairs = append(pairs, KeyValuePair{Key: path + "." + attr.Name.Local, Value: attr.Value})
+			}
+			// <add key="ApiKey" value="..."/> and <entry name="password" value="..."/> style settings
+			if value, ok := attributes["value"]; ok {
+				for _, name := range []string{"key", "name"} {
+					if key, ok := attributes[name]; ok {
+						pairs = append(pairs, KeyValuePair{Key: key, Value: value})
+					}
+				}
+			}
+		case xml.EndElement:
+			if len(elements) > 0 {
+				elements = elements[:len(elements)-1]
+			}
+		case xml.CharData:
+			if text := strings.TrimSpace(string(t)); text != "" && len(elements) > 0 {
+				pairs = append(pairs, KeyValuePair{Key: strings.Join(elements, "."), Value: text})
+			}
+		}
+	}
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
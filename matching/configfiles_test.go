@@ -0,0 +1,95 @@
+package matching
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractKeyValues(t *testing.T) {
+	tests := []struct {
+		filename string
+		content  string
+		want     []KeyValuePair
+	}{
+		{
+			filename: ".env.production",
+			content:  "# comment\nexport DB_PASSWORD=\"s3cr3t\"\nAPI_KEY=abc123\n",
+			want:     []KeyValuePair{{"DB_PASSWORD", "s3cr3t"}, {"API_KEY", "abc123"}},
+		},
+		{
+			filename: "config/settings.yml",
+			content:  "database:\n  password: s3cr3t\n  hosts:\n    - db1\n",
+			want:     []KeyValuePair{{"database.hosts.0", "db1"}, {"database.password", "s3cr3t"}},
+		},
+		{
+			filename: "app.json",
+			content:  `{"aws": {"secret": "abc"}, "port": 80}`,
+			want:     []KeyValuePair{{"aws.secret", "abc"}, {"port", "80"}},
+		},
+		{
+			filename: "partial.json",
+			content:  "  \"password\": \"s3cr3t\",\n  \"user\": \"root\"",
+			want:     []KeyValuePair{{"password", "s3cr3t"}, {"user", "root"}},
+		},
+		{
+			filename: "setup.cfg",
+			content:  "[database]\npassword = s3cr3t\n; comment\n[smtp]\nuser: mail\n",
+			want:     []KeyValuePair{{"database.password", "s3cr3t"}, {"smtp.user", "mail"}},
+		},
+		{
+			filename: "app.properties",
+			content:  "db.password=s3cr3t\ndb.user: root\n",
+			want:     []KeyValuePair{{"db.password", "s3cr3t"}, {"db.user", "root"}},
+		},
+		{
+			filename: "main.tf",
+			content:  "resource \"aws_db_instance\" \"db\" {\n  password = \"s3cr3t\"\n}\n",
+			want:     []KeyValuePair{{"resource.aws_db_instance.db.password", "s3cr3t"}},
+		},
+		{
+			filename: "web.config",
+			content:  `<configuration><add key="ApiKey" value="abc123"/><password>s3cr3t</password></configuration>`,
+			want: []KeyValuePair{{"configuration.add.key", "ApiKey"}, {"configuration.add.value", "abc123"},
+				{"ApiKey", "abc123"}, {"configuration.password", "s3cr3t"}},
+		},
+		{
+			filename: "main.go",
+			content:  "password = \"s3cr3t\"",
+			want:     nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			got := ExtractKeyValues(test.filename, test.content)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ExtractKeyValues = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestKeyValueSignatureMatch(t *testing.T) {
+	signature := KeyValueSignature{KeyMatchOn: `(?i)password`, ValueMatchOn: `.{6,}`}
+	tests := []struct {
+		pair KeyValuePair
+		want bool
+	}{
+		{KeyValuePair{"db.password", "hunter22"}, true},
+		{KeyValuePair{"db.password", "short"}, false},
+		{KeyValuePair{"db.user", "hunter22"}, false},
+		{KeyValuePair{"db.password", "${DB_PASSWORD}"}, false},
+		{KeyValuePair{"db.password", "changeme"}, false},
+		{KeyValuePair{"db.password", "<password>"}, false},
+		{KeyValuePair{"db.password", "{{ .Values.password }}"}, false},
+		{KeyValuePair{"db.password", "var.password"}, false},
+	}
+	for _, test := range tests {
+		got, err := signature.Match(test.pair)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("Match(%v) = %v, want %v", test.pair, got, test.want)
+		}
+	}
+}
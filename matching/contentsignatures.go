@@ -1,15 +1,84 @@
 package matching
 
-import "regexp"
+import (
+	"regexp"
+	"sync"
+)
 
 type ContentSignature struct {
-	MatchOn     string
-	Description string
-	Comment     string
+	ID              string
+	Severity        string
+	Confidence      string
+	MatchOn         string
+	Keywords        []string `json:",omitempty"`
+	Description     string
+	Comment         string
+	Verifier        string   `json:",omitempty"`
+	IncludePaths    []string `json:",omitempty"`
+	ExcludePaths    []string `json:",omitempty"`
+	FileTypes       []string `json:",omitempty"`
+	Examples        []string `json:",omitempty"`
+	Counterexamples []string `json:",omitempty"`
+}
+
+var patternCache sync.Map
+
+// compilePattern compiles a pattern once and returns the cached regular
+// expression afterwards.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if r, ok := patternCache.Load(pattern); ok {
+		return r.(*regexp.Regexp), nil
+	}
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, r)
+	return r, nil
+}
+
+// matchPattern reports whether the text contains a match of the cached pattern.
+func matchPattern(pattern, text string) (bool, error) {
+	r, err := compilePattern(pattern)
+	if err != nil {
+		return false, err
+	}
+	return r.MatchString(text), nil
 }
 
 func (c ContentSignature) Match(target MatchTarget) (bool, error) {
-	return regexp.MatchString(c.MatchOn, target.Content)
+	r, err := compilePattern(c.MatchOn)
+	if err != nil {
+		return false, err
+	}
+	return r.MatchString(target.Content), nil
+}
+
+// Find returns the first text in the target content matched by the signature.
+func (c ContentSignature) Find(target MatchTarget) (string, bool, error) {
+	loc, err := c.FindIndex(target)
+	if loc == nil || err != nil {
+		return "", false, err
+	}
+	return target.Content[loc[0]:loc[1]], true, nil
+}
+
+// FindIndex returns the location of the first match in the target content.
+func (c ContentSignature) FindIndex(target MatchTarget) ([]int, error) {
+	r, err := compilePattern(c.MatchOn)
+	if err != nil {
+		return nil, err
+	}
+	return r.FindStringIndex(target.Content), nil
+}
+
+// FindAllIndex returns the locations of all matches in the target content.
+func (c ContentSignature) FindAllIndex(target MatchTarget) ([][]int, error) {
+	r, err := compilePattern(c.MatchOn)
+	if err != nil {
+		return nil, err
+	}
+	return r.FindAllStringIndex(target.Content, -1), nil
 }
 
 func (c ContentSignature) GetDescription() string {
@@ -19,3 +88,15 @@ func (c ContentSignature) GetDescription() string {
 func (c ContentSignature) GetComment() string {
 	return c.Comment
 }
+
+func (c ContentSignature) GetID() string {
+	return c.ID
+}
+
+func (c ContentSignature) GetSeverity() string {
+	return c.Severity
+}
+
+func (c ContentSignature) GetConfidence() string {
+	return c.Confidence
+}
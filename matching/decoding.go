@@ -0,0 +1,111 @@
+package matching
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	EncodingBase64 = "base64"
+	EncodingHex    = "hex"
+	EncodingURL    = "url"
+)
+
+type DecodedContent struct {
+	Content       string
+	EncodingChain []string
+}
+
+type decoder struct {
+	encoding string
+	pattern  *regexp.Regexp
+	decode   func(string) (string, bool)
+}
+
+var decoders = []decoder{
+	{encoding: EncodingBase64, pattern: regexp.MustCompile(`[A-Za-z0-9+/_-]{16,}={0,2}`), decode: decodeBase64},
+	{encoding: EncodingHex, pattern: regexp.MustCompile(`\b(?:[0-9a-fA-F]{2}){8,}\b`), decode: decodeHex},
+	{encoding: EncodingURL, pattern: regexp.MustCompile(`(?:[^\s%]*%[0-9A-Fa-f]{2}){2,}[^\s%]*`), decode: decodeURL},
+}
+
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.RawStdEncoding,
+	base64.URLEncoding,
+	base64.RawURLEncoding,
+}
+
+// DecodeContent returns views of content in which every base64, hex or
+// URL-encoded blob that decodes to printable text is replaced by its decoded
+// value. Decoded views are decoded again up to maxDepth times, and each view
+// records the chain of encodings that produced it.
+func DecodeContent(content string, maxDepth int) []DecodedContent {
+	var results []DecodedContent
+	seen := map[string]bool{content: true}
+	decodeLayers(content, nil, maxDepth, seen, &results)
+	return results
+}
+
+func decodeLayers(content string, chain []string, depth int, seen map[string]bool, results *[]DecodedContent) {
+	if depth <= 0 {
+		return
+	}
+	for _, d := range decoders {
+		replaced := false
+		view := d.pattern.ReplaceAllStringFunc(content, func(blob string) string {
+			decoded, ok := d.decode(blob)
+			if !ok {
+				return blob
+			}
+			replaced = true
+			return decoded
+		})
+		if !replaced || seen[view] {
+			continue
+		}
+		seen[view] = true
+		layerChain := append(append([]string{}, chain...), d.encoding)
+		*results = append(*results, DecodedContent{Content: view, EncodingChain: layerChain})
+		decodeLayers(view, layerChain, depth-1, seen, results)
+	}
+}
+
+func decodeBase64(blob string) (string, bool) {
+	for _, encoding := range base64Encodings {
+		decoded, err := encoding.DecodeString(blob)
+		if err == nil {
+			return string(decoded), isPrintable(string(decoded))
+		}
+	}
+	return "", false
+}
+
+func decodeHex(blob string) (string, bool) {
+	decoded, err := hex.DecodeString(blob)
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), isPrintable(string(decoded))
+}
+
+func decodeURL(blob string) (string, bool) {
+	decoded, err := url.PathUnescape(blob)
+	if err != nil || decoded == blob {
+		return "", false
+	}
+	return decoded, isPrintable(decoded)
+}
+
+func isPrintable(s string) bool {
+	if s == "" || !utf8.ValidString(s) {
+		return false
+	}
+	return strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsPrint(r) && !unicode.IsSpace(r)
+	}) == -1
+}
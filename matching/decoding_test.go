@@ -0,0 +1,93 @@
+package matching
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeContent(t *testing.T) {
+	secret := "aws_secret_access_key=wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+	base64Secret := base64.StdEncoding.EncodeToString([]byte(secret))
+	tests := []struct {
+		name      string
+		content   string
+		maxDepth  int
+		want      string
+		wantChain []string
+	}{
+		{
+			name:      "base64",
+			content:   "data: " + base64Secret,
+			maxDepth:  2,
+			want:      "data: " + secret,
+			wantChain: []string{EncodingBase64},
+		},
+		{
+			name:      "hex",
+			content:   "key " + hex.EncodeToString([]byte("password=hunter2")),
+			maxDepth:  2,
+			want:      "key password=hunter2",
+			wantChain: []string{EncodingHex},
+		},
+		{
+			name:      "url",
+			content:   "https://host/?q=password%3Dhunter2%26user%3Droot",
+			maxDepth:  2,
+			want:      "https://host/?q=password=hunter2&user=root",
+			wantChain: []string{EncodingURL},
+		},
+		{
+			name:      "base64 of hex",
+			content:   base64.StdEncoding.EncodeToString([]byte(hex.EncodeToString([]byte("password=hunter2")))),
+			maxDepth:  2,
+			want:      "password=hunter2",
+			wantChain: []string{EncodingBase64, EncodingHex},
+		},
+		{
+			name:     "depth limits nested decoding",
+			content:  base64.StdEncoding.EncodeToString([]byte(hex.EncodeToString([]byte("password=hunter2")))),
+			maxDepth: 1,
+			want:     "",
+		},
+		{
+			name:     "binary data isn't a view",
+			content:  base64.StdEncoding.EncodeToString([]byte{0x00, 0x01, 0x02, 0xff, 0xfe, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16}),
+			maxDepth: 2,
+			want:     "",
+		},
+		{
+			name:     "zero depth decodes nothing",
+			content:  "data: " + base64Secret,
+			maxDepth: 0,
+			want:     "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var found *DecodedContent
+			results := DecodeContent(test.content, test.maxDepth)
+			for i := range results {
+				if test.want != "" && results[i].Content == test.want {
+					found = &results[i]
+				}
+			}
+			if test.want == "" {
+				for _, result := range results {
+					if strings.Contains(result.Content, "password=hunter2") || strings.Contains(result.Content, secret) {
+						t.Fatalf("unexpected view %q", result.Content)
+					}
+				}
+				return
+			}
+			if found == nil {
+				t.Fatalf("no view %q in %+v", test.want, results)
+			}
+			if !reflect.DeepEqual(found.EncodingChain, test.wantChain) {
+				t.Errorf("chain = %v, want %v", found.EncodingChain, test.wantChain)
+			}
+		})
+	}
+}
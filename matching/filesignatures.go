@@ -2,7 +2,6 @@ package matching
 
 import (
 	"fmt"
-	"regexp"
 )
 
 type FileSignatureType struct {
@@ -18,10 +17,15 @@ var fileSignatureTypes = FileSignatureType{
 }
 
 type FileSignature struct {
-	Part        string
-	MatchOn     string
-	Description string
-	Comment     string
+	ID              string
+	Severity        string
+	Confidence      string
+	Part            string
+	MatchOn         string
+	Description     string
+	Comment         string
+	Examples        []string `json:",omitempty"`
+	Counterexamples []string `json:",omitempty"`
 }
 
 func (f FileSignature) Match(target MatchTarget) (bool, error) {
@@ -36,7 +40,7 @@ func (f FileSignature) Match(target MatchTarget) (bool, error) {
 	default:
 		return false, fmt.Errorf("unrecognized 'Part' parameter: %s", f.Part)
 	}
-	return regexp.MatchString(f.MatchOn, *haystack)
+	return matchPattern(f.MatchOn, *haystack)
 }
 
 func (f FileSignature) GetDescription() string {
@@ -46,3 +50,15 @@ func (f FileSignature) GetDescription() string {
 func (f FileSignature) GetComment() string {
 	return f.Comment
 }
+
+func (f FileSignature) GetID() string {
+	return f.ID
+}
+
+func (f FileSignature) GetSeverity() string {
+	return f.Severity
+}
+
+func (f FileSignature) GetConfidence() string {
+	return f.Confidence
+}
@@ -1,19 +1,39 @@
 package matching
 
 import (
+	"crypto/hmac"
 	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 )
 
 type Finding struct {
 	ID                          string
+	Fingerprint                 string
 	FilePath                    string
+	Line                        int
 	Action                      string
+	Category                    string
+	FileSignatureID             string
 	FileSignatureDescription    string
 	FileSignatureComment        string
+	ContentSignatureID          string
 	ContentSignatureDescription string
 	ContentSignatureComment     string
+	Severity                    string
+	Confidence                  string
+	ConfigKey                   string
+	RedactedValue               string
+	EncodingChain               []string
+	KeyMetadata                 *KeyMetadata
+	JWT                         *JWTMetadata
+	Downgraded                  bool
+	Verifier                    string
+	VerificationStatus          string
+	Suppression                 *Suppression
+	Triage                      *Triage
 	RepositoryOwner             string
 	RepositoryName              string
 	CommitHash                  string
@@ -45,3 +65,54 @@ func (f *Finding) GenerateID() (string, error) {
 
 	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
+
+// GenerateFingerprint identifies the matched value in the file across commits
+// and scans, unlike the ID, which identifies the change that introduced it.
+// Only a hash of the value goes into the fingerprint. Personal data is hashed
+// with an HMAC under key instead, since there are few enough national IDs and
+// card numbers to reverse a plain hash of the value.
+func (f *Finding) GenerateFingerprint(value string, key []byte) (string, error) {
+	valueHash := fmt.Sprintf("%x", sha256.Sum256([]byte(value)))
+	if f.Category == CategoryPII {
+		if len(key) == 0 {
+			return "", errors.New("fingerprinting personal data needs a key")
+		}
+		mac := hmac.New(sha256.New, key)
+		if _, err := io.WriteString(mac, value); err != nil {
+			return "", err
+		}
+		valueHash = fmt.Sprintf("%x", mac.Sum(nil))
+	}
+	h := sha1.New() //nolint:gosec
+
+	for _, s := range []string{
+		f.RepositoryOwner,
+		f.RepositoryName,
+		f.FilePath,
+		f.FileSignatureID,
+		f.ContentSignatureID,
+		f.ConfigKey,
+		valueHash,
+	} {
+		_, err := io.WriteString(h, s+"\x00")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Redact removes what shouldn't leave the team that ran the scan from a
+// finding: email addresses of commit authors, in commit messages and in JWT
+// claims. Matched values aren't stored, except for PII, which is stored
+// redacted.
+func (f *Finding) Redact() {
+	f.CommitAuthor = RedactEmails(f.CommitAuthor)
+	f.CommitMessage = RedactEmails(f.CommitMessage)
+	if f.JWT != nil {
+		jwt := *f.JWT
+		jwt.Issuer, jwt.Subject = RedactEmails(jwt.Issuer), RedactEmails(jwt.Subject)
+		f.JWT = &jwt
+	}
+}
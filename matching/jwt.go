@@ -0,0 +1,178 @@
+package matching
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var jwtRegex = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]*`)
+
+var (
+	jwtSignature = ContentSignature{
+		ID:          "jwt",
+		Severity:    SeverityHigh,
+		Confidence:  ConfidenceHigh,
+		Description: "JSON Web Token",
+		Comment:     "A bearer token that grants access until it expires.",
+	}
+	// expiredJWTSignature keeps the ID of jwtSignature, so that fingerprints,
+	// triage and suppressions of a token don't change when it expires.
+	expiredJWTSignature = ContentSignature{
+		ID:          "jwt",
+		Severity:    SeverityLow,
+		Confidence:  ConfidenceHigh,
+		Description: "Expired JSON Web Token",
+		Comment:     "The token has expired, but its claims may still reveal internal issuers and subjects.",
+	}
+)
+
+// JWTMetadata holds the header and registered claims of a JSON Web Token.
+type JWTMetadata struct {
+	Algorithm string
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt *time.Time
+	Expired   bool
+	Unsigned  bool
+}
+
+type jwtHeader struct {
+	Algorithm *string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ParseJWT decodes the header and payload of a token without checking its
+// signature. Tokens whose header has no alg are not JWTs.
+func ParseJWT(token string) (*JWTMetadata, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	var header jwtHeader
+	var claims jwtClaims
+	if decodeJWTSegment(parts[0], &header) != nil || header.Algorithm == nil || decodeJWTSegment(parts[1], &claims) != nil {
+		return nil, false
+	}
+	metadata := &JWTMetadata{
+		Algorithm: *header.Algorithm,
+		Issuer:    claims.Issuer,
+		Subject:   claims.Subject,
+		Unsigned:  strings.EqualFold(*header.Algorithm, "none"),
+	}
+	var audience string
+	if json.Unmarshal(claims.Audience, &audience) == nil && audience != "" {
+		metadata.Audience = []string{audience}
+	} else {
+		_ = json.Unmarshal(claims.Audience, &metadata.Audience)
+	}
+	if claims.ExpiresAt != nil {
+		expiresAt := time.Unix(int64(*claims.ExpiresAt), 0).UTC()
+		metadata.ExpiresAt = &expiresAt
+		metadata.Expired = expiresAt.Before(time.Now())
+	}
+	return metadata, true
+}
+
+func (j *JWTMetadata) String() string {
+	parts := []string{"alg " + j.Algorithm}
+	if j.Unsigned {
+		parts[0] += " (unsigned)"
+	}
+	if j.Issuer != "" {
+		parts = append(parts, "iss "+j.Issuer)
+	}
+	if j.Subject != "" {
+		parts = append(parts, "sub "+j.Subject)
+	}
+	if len(j.Audience) > 0 {
+		parts = append(parts, "aud "+strings.Join(j.Audience, ","))
+	}
+	if j.ExpiresAt != nil {
+		exp := "exp " + j.ExpiresAt.Format(time.RFC3339)
+		if j.Expired {
+			exp += " (expired)"
+		}
+		parts = append(parts, exp)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// jwtMatcher reports every distinct JSON Web Token in the content with its
+// claims. Expired tokens are reported with a low severity and unsigned tokens
+// are called out in the description.
+type jwtMatcher struct{}
+
+func (jwtMatcher) Name() string {
+	return "jwt"
+}
+
+func (jwtMatcher) Match(file *File) ([]Match, error) {
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	var matches []Match
+	seen := make(map[string]bool)
+	for _, content := range contents {
+		if !strings.Contains(content.Content, "eyJ") {
+			continue
+		}
+		locations := make(map[string][][]int)
+		var tokens []string
+		for _, loc := range jwtRegex.FindAllStringIndex(content.Content, -1) {
+			token := content.Content[loc[0]:loc[1]]
+			if seen[token] {
+				continue
+			}
+			if _, ok := locations[token]; !ok {
+				tokens = append(tokens, token)
+			}
+			locations[token] = append(locations[token], loc)
+		}
+		for _, token := range tokens {
+			seen[token] = true
+			metadata, ok := ParseJWT(token)
+			if !ok {
+				continue
+			}
+			signature := jwtSignature
+			if metadata.Expired {
+				signature = expiredJWTSignature
+			}
+			if metadata.Unsigned {
+				signature.Description += " with alg none"
+				signature.Comment = "The token is unsigned, so it is only accepted by services that don't check signatures."
+			}
+			matches = append(matches, Match{
+				ContentSignature: signature,
+				Content:          content.Content,
+				Locations:        locations[token],
+				EncodingChain:    content.EncodingChain,
+				JWT:              metadata,
+			})
+		}
+	}
+	return matches, nil
+}
+
+func init() {
+	RegisterMatcher(jwtMatcher{})
+}
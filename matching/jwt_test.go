@@ -0,0 +1,96 @@
+package matching
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testJWT(header, payload string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(header)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+func TestParseJWT(t *testing.T) {
+	expired := time.Unix(1500000000, 0).UTC()
+	future := time.Unix(4100000000, 0).UTC()
+	tests := []struct {
+		name  string
+		token string
+		want  *JWTMetadata
+	}{
+		{
+			name:  "registered claims",
+			token: testJWT(`{"alg":"RS256","typ":"JWT"}`, `{"iss":"https://auth.example.com","sub":"user-1","aud":"api","exp":4100000000}`),
+			want: &JWTMetadata{Algorithm: "RS256", Issuer: "https://auth.example.com", Subject: "user-1",
+				Audience: []string{"api"}, ExpiresAt: &future},
+		},
+		{
+			name:  "expired token with several audiences",
+			token: testJWT(`{"alg":"HS256"}`, `{"aud":["api","web"],"exp":1500000000}`),
+			want:  &JWTMetadata{Algorithm: "HS256", Audience: []string{"api", "web"}, ExpiresAt: &expired, Expired: true},
+		},
+		{
+			name:  "unsigned token",
+			token: testJWT(`{"alg":"none"}`, `{"sub":"admin"}`),
+			want:  &JWTMetadata{Algorithm: "none", Subject: "admin", Unsigned: true},
+		},
+		{
+			name:  "header without alg",
+			token: testJWT(`{"typ":"JWT"}`, `{"sub":"admin"}`),
+		},
+		{
+			name:  "payload that isn't JSON",
+			token: testJWT(`{"alg":"HS256"}`, `not json`),
+		},
+		{
+			name:  "two segments",
+			token: "eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJhZG1pbiJ9",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := ParseJWT(test.token)
+			if ok != (test.want != nil) {
+				t.Fatalf("ParseJWT ok = %v, want %v", ok, test.want != nil)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseJWT = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJWTMatcher(t *testing.T) {
+	valid := testJWT(`{"alg":"HS256"}`, `{"sub":"user-1","exp":4100000000}`)
+	expired := testJWT(`{"alg":"HS256"}`, `{"sub":"user-2","exp":1500000000}`)
+	unsigned := testJWT(`{"alg":"none"}`, `{"sub":"admin"}`)
+	content := strings.Join([]string{"token: " + valid, "old: " + expired, "again: " + valid, "none: " + unsigned}, "\n")
+	file := NewFile(NewMatchTarget("fixtures/session.har"), func() (string, error) { return content, nil }, nil, 0)
+	matches, err := jwtMatcher{}.Match(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		id, severity, description string
+		locations                 int
+	}{
+		{"jwt", SeverityHigh, "JSON Web Token", 2},
+		{"jwt", SeverityLow, "Expired JSON Web Token", 1},
+		{"jwt", SeverityHigh, "JSON Web Token with alg none", 1},
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d", len(matches), len(want))
+	}
+	for i, match := range matches {
+		signature := match.ContentSignature.(ContentSignature)
+		if signature.ID != want[i].id || signature.Severity != want[i].severity ||
+			signature.Description != want[i].description || len(match.Locations) != want[i].locations {
+			t.Errorf("match %d = %s %s %q with %d locations, want %s %s %q with %d", i, signature.ID, signature.Severity,
+				signature.Description, len(match.Locations), want[i].id, want[i].severity, want[i].description,
+				want[i].locations)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package matching
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/dsa" //nolint:staticcheck
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/pkcs12"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	KeyFormatPEM     = "PEM"
+	KeyFormatOpenSSH = "OpenSSH"
+	KeyFormatPuTTY   = "PuTTY"
+	KeyFormatPKCS12  = "PKCS#12"
+	KeyFormatJKS     = "JKS"
+
+	jksMagic   = 0xFEEDFEED
+	jceksMagic = 0xCECECECE
+)
+
+type KeyMetadata struct {
+	Format      string
+	Type        string
+	Private     bool
+	Encrypted   bool
+	Valid       bool
+	Algorithm   string
+	Bits        int
+	Fingerprint string
+}
+
+var keyExtensions = []string{".pem", ".key", ".p8", ".der", ".p12", ".pfx", ".jks", ".keystore", ".jceks", ".ppk", ".pub"}
+var keyFilenameRegex = regexp.MustCompile(`^id_(rsa|dsa|ecdsa|ed25519)(\.pub)?$`)
+var puttyHeaderRegex = regexp.MustCompile(`(?m)^PuTTY-User-Key-File-\d+:\s*(\S+)\s*$`)
+var puttyEncryptionRegex = regexp.MustCompile(`(?m)^Encryption:\s*(\S+)\s*$`)
+
+// IsKeyCandidate reports whether the name of a file suggests that it contains
+// key material even if no PEM block can be found in it.
+func IsKeyCandidate(filename string) bool {
+	filename = strings.ToLower(filename)
+	if keyFilenameRegex.MatchString(filename) {
+		return true
+	}
+	ext := filepath.Ext(filename)
+	for _, keyExt := range keyExtensions {
+		if ext == keyExt {
+			return true
+		}
+	}
+	return false
+}
+
+// InspectKey looks for PEM, OpenSSH, PuTTY, PKCS#12 and JKS key material in
+// data and describes the most sensitive key it finds. It returns nil when the
+// data contains no key material and the filename does not suggest a key.
+func InspectKey(filename string, data []byte) *KeyMetadata {
+	if metadata := inspectPEM(data); metadata != nil {
+		return metadata
+	}
+	if metadata := inspectAuthorizedKey(data); metadata != nil {
+		return metadata
+	}
+	if metadata := inspectPuTTY(data); metadata != nil {
+		return metadata
+	}
+	if len(data) >= 4 {
+		if magic := binary.BigEndian.Uint32(data); magic == jksMagic || magic == jceksMagic {
+			return inspectJKS(data)
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".p12" || ext == ".pfx" {
+		return inspectPKCS12(data)
+	}
+	if IsKeyCandidate(filename) {
+		return &KeyMetadata{Valid: false}
+	}
+	return nil
+}
+
+// InspectKeyMatch describes the key that the match from start to end in
+// content is part of: the PEM block whose BEGIN line it is on, the PuTTY key
+// whose header it is on, or the OpenSSH public key on its line. The rest of
+// the content is not looked at. It returns nil when the match is not part of
+// a key or the key can't be delimited.
+func InspectKeyMatch(content string, start, end int) *KeyMetadata {
+	lineStart := strings.LastIndex(content[:start], "\n") + 1
+	lineEnd := len(content)
+	if i := strings.Index(content[end:], "\n"); i != -1 {
+		lineEnd = end + i
+	}
+	if begin := strings.LastIndex(content[:lineEnd], "-----BEGIN "); begin >= lineStart {
+		i := strings.Index(content[begin:], "-----END ")
+		if i == -1 {
+			return nil
+		}
+		blockEnd := len(content)
+		if j := strings.Index(content[begin+i:], "\n"); j != -1 {
+			blockEnd = begin + i + j
+		}
+		block, _ := pem.Decode([]byte(content[begin:blockEnd]))
+		if block == nil {
+			return nil
+		}
+		return inspectPEMBlock(block)
+	}
+	line := content[lineStart:lineEnd]
+	if strings.HasPrefix(line, "PuTTY-User-Key-File-") {
+		return inspectPuTTY([]byte(content[lineStart:]))
+	}
+	return inspectAuthorizedKey([]byte(line))
+}
+
+func inspectPEM(data []byte) *KeyMetadata {
+	var first *KeyMetadata
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return first
+		}
+		metadata := inspectPEMBlock(block)
+		if metadata.Private && metadata.Valid {
+			return metadata
+		}
+		if first == nil || (metadata.Private && !first.Private) {
+			first = metadata
+		}
+	}
+}
+
+func inspectPEMBlock(block *pem.Block) *KeyMetadata {
+	metadata := &KeyMetadata{Format: KeyFormatPEM, Type: block.Type}
+	switch {
+	case block.Type == "CERTIFICATE":
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			metadata.Valid = true
+			describePublicKey(metadata, certificate.PublicKey)
+		}
+	case strings.HasSuffix(block.Type, "PUBLIC KEY"):
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		}
+		if err == nil {
+			metadata.Valid = true
+			describePublicKey(metadata, publicKey)
+		}
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		metadata.Private = true
+		metadata.Encrypted = true
+		metadata.Valid = len(block.Bytes) > 0
+	case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+		metadata.Private = true
+		if block.Type == "OPENSSH PRIVATE KEY" {
+			metadata.Format = KeyFormatOpenSSH
+		}
+		privateKey, err := ssh.ParseRawPrivateKey(pem.EncodeToMemory(block))
+		var passphraseErr *ssh.PassphraseMissingError
+		switch {
+		case errors.As(err, &passphraseErr):
+			metadata.Encrypted = true
+			metadata.Valid = true
+			if passphraseErr.PublicKey != nil {
+				metadata.Algorithm = passphraseErr.PublicKey.Type()
+				metadata.Fingerprint = ssh.FingerprintSHA256(passphraseErr.PublicKey)
+				if cryptoKey, ok := passphraseErr.PublicKey.(ssh.CryptoPublicKey); ok {
+					describePublicKey(metadata, cryptoKey.CryptoPublicKey())
+				}
+			}
+		case err == nil:
+			metadata.Valid = true
+			if signer, ok := privateKey.(crypto.Signer); ok {
+				describePublicKey(metadata, signer.Public())
+			} else if dsaKey, ok := privateKey.(*dsa.PrivateKey); ok {
+				describePublicKey(metadata, &dsaKey.PublicKey)
+			}
+		}
+	}
+	return metadata
+}
+
+func inspectAuthorizedKey(data []byte) *KeyMetadata {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil
+	}
+	metadata := &KeyMetadata{Format: KeyFormatOpenSSH, Type: "PUBLIC KEY", Valid: true}
+	metadata.Algorithm = publicKey.Type()
+	metadata.Fingerprint = ssh.FingerprintSHA256(publicKey)
+	if cryptoKey, ok := publicKey.(ssh.CryptoPublicKey); ok {
+		describePublicKey(metadata, cryptoKey.CryptoPublicKey())
+	}
+	return metadata
+}
+
+func inspectPuTTY(data []byte) *KeyMetadata {
+	header := puttyHeaderRegex.FindSubmatch(data)
+	if header == nil {
+		return nil
+	}
+	metadata := &KeyMetadata{
+		Format:    KeyFormatPuTTY,
+		Type:      "PRIVATE KEY",
+		Private:   true,
+		Valid:     bytes.Contains(data, []byte("Private-Lines:")),
+		Algorithm: string(header[1]),
+	}
+	if encryption := puttyEncryptionRegex.FindSubmatch(data); encryption != nil {
+		metadata.Encrypted = string(encryption[1]) != "none"
+	}
+	return metadata
+}
+
+func inspectPKCS12(data []byte) *KeyMetadata {
+	metadata := &KeyMetadata{Format: KeyFormatPKCS12, Type: "PKCS12"}
+	privateKey, certificate, err := pkcs12.Decode(data, "")
+	if err == nil {
+		metadata.Valid = true
+		metadata.Private = true
+		if signer, ok := privateKey.(crypto.Signer); ok {
+			describePublicKey(metadata, signer.Public())
+		} else {
+			describePublicKey(metadata, certificate.PublicKey)
+		}
+		return metadata
+	}
+	var notImplemented pkcs12.NotImplementedError
+	if err == pkcs12.ErrIncorrectPassword || errors.As(err, &notImplemented) {
+		// the bundle is protected or uses unsupported ciphers, so it has to be assumed to hold a private key
+		metadata.Valid = true
+		metadata.Private = true
+		metadata.Encrypted = true
+		return metadata
+	}
+	// bundles that don't hold exactly one key and one certificate
+	blocks, err := pkcs12.ToPEM(data, "")
+	if err != nil {
+		return metadata
+	}
+	metadata.Valid = true
+	for _, block := range blocks {
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			metadata.Private = true
+		} else if parsed, err := x509.ParseCertificate(block.Bytes); err == nil && metadata.Algorithm == "" {
+			describePublicKey(metadata, parsed.PublicKey)
+		}
+	}
+	return metadata
+}
+
+// inspectJKS walks the entries of a Java (JKS or JCEKS) keystore. Private key
+// entries are always protected by a password, so only the certificate chain
+// attached to them is parsed.
+func inspectJKS(data []byte) *KeyMetadata {
+	const (
+		privateKeyEntry  = 1
+		trustedCertEntry = 2
+		headerLength     = 12
+	)
+	metadata := &KeyMetadata{Format: KeyFormatJKS, Type: "KEYSTORE"}
+	r := &keystoreReader{data: data, offset: headerLength}
+	if len(data) < headerLength {
+		return metadata
+	}
+	count := binary.BigEndian.Uint32(data[8:])
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		r.utf()   // alias
+		r.skip(8) // timestamp
+		switch tag {
+		case privateKeyEntry:
+			r.bytes() // password protected key
+			chainLength := r.uint32()
+			for j := uint32(0); j < chainLength && r.err == nil; j++ {
+				r.utf()
+				certificate := r.bytes()
+				if j == 0 && !metadata.Private && r.err == nil {
+					metadata.Private = true
+					metadata.Encrypted = true
+					if parsed, err := x509.ParseCertificate(certificate); err == nil {
+						describePublicKey(metadata, parsed.PublicKey)
+					}
+				}
+			}
+		case trustedCertEntry:
+			r.utf()
+			r.bytes()
+		default:
+			// JCEKS secret key entries are serialized Java objects and can't be skipped
+			r.err = errors.New("unsupported keystore entry")
+		}
+	}
+	metadata.Valid = r.err == nil || metadata.Private
+	return metadata
+}
+
+type keystoreReader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *keystoreReader) skip(n int) []byte {
+	if r.err != nil || n < 0 || r.offset+n > len(r.data) {
+		r.err = errors.New("truncated keystore")
+		return nil
+	}
+	b := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return b
+}
+
+func (r *keystoreReader) uint32() uint32 {
+	if b := r.skip(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *keystoreReader) utf() string {
+	if b := r.skip(2); b != nil {
+		return string(r.skip(int(binary.BigEndian.Uint16(b))))
+	}
+	return ""
+}
+
+func (r *keystoreReader) bytes() []byte {
+	return r.skip(int(r.uint32()))
+}
+
+func describePublicKey(metadata *KeyMetadata, publicKey interface{}) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		metadata.Algorithm = "RSA"
+		metadata.Bits = key.N.BitLen()
+	case *ecdsa.PublicKey:
+		metadata.Algorithm = "ECDSA"
+		metadata.Bits = key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		metadata.Algorithm = "Ed25519"
+		metadata.Bits = 256
+	case *dsa.PublicKey:
+		metadata.Algorithm = "DSA"
+		metadata.Bits = key.P.BitLen()
+	default:
+		return
+	}
+	if sshKey, err := ssh.NewPublicKey(publicKey); err == nil {
+		metadata.Fingerprint = ssh.FingerprintSHA256(sshKey)
+	}
+}
+
+func (k *KeyMetadata) String() string {
+	var parts []string
+	if k.Algorithm != "" {
+		if k.Bits > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d-bit", k.Algorithm, k.Bits))
+		} else {
+			parts = append(parts, k.Algorithm)
+		}
+	}
+	switch {
+	case !k.Valid:
+		parts = append(parts, "invalid key")
+	case k.Private:
+		parts = append(parts, "private key")
+	default:
+		parts = append(parts, "public key")
+	}
+	if k.Format != "" {
+		parts = append(parts, "("+k.Format+")")
+	}
+	if k.Encrypted {
+		parts = append(parts, "encrypted")
+	}
+	if k.Fingerprint != "" {
+		parts = append(parts, k.Fingerprint)
+	}
+	return strings.Join(parts, " ")
+}
+
+// keyInspector describes the key material of file matches of key files, by
+// the whole file, and of content matches that are part of a key block.
+type keyInspector struct{}
+
+func (keyInspector) Name() string {
+	return "keys"
+}
+
+// Match reports nothing, keys are found by signatures.
+func (keyInspector) Match(*File) ([]Match, error) {
+	return nil, nil
+}
+
+func (keyInspector) Inspect(file *File, match *Match) error {
+	switch {
+	case match.ContentSignature == nil:
+		if !IsKeyCandidate(file.Target.Filename) {
+			return nil
+		}
+		data, err := file.Blob()
+		if err != nil {
+			return err
+		}
+		match.KeyMetadata = InspectKey(file.Target.Filename, data)
+	case len(match.Locations) > 0:
+		loc := match.Locations[0]
+		match.KeyMetadata = InspectKeyMatch(match.Content, loc[0], loc[1])
+	}
+	return nil
+}
+
+func init() {
+	RegisterMatcher(keyInspector{})
+}
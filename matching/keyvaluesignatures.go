@@ -0,0 +1,75 @@
+package matching
+
+import (
+	"regexp"
+	"strings"
+)
+
+type KeyValueSignature struct {
+	ID              string
+	Severity        string
+	Confidence      string
+	KeyMatchOn      string
+	ValueMatchOn    string
+	Description     string
+	Comment         string
+	Verifier        string   `json:",omitempty"`
+	Examples        []string `json:",omitempty"`
+	Counterexamples []string `json:",omitempty"`
+}
+
+var placeholderRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`^\$\{?[A-Za-z0-9_.:\-]+\}?$`),                      // ${VAR}, $VAR, ${VAR:-default}
+	regexp.MustCompile(`^\{\{.*\}\}$`),                                     // {{ template }}
+	regexp.MustCompile(`^%\(?[A-Za-z0-9_]+\)?s?%?$`),                       // %(name)s, %VAR%
+	regexp.MustCompile(`^<[^>]*>$`),                                        // <password>
+	regexp.MustCompile(`^(?i)(process\.env|os\.environ|env|getenv|var)\b`), // env lookups and Terraform variables
+	regexp.MustCompile(`^(?i)(changeme|change_me|changeit|password|passwd|secret|example|sample|dummy|test|todo|tbd)$`),
+	regexp.MustCompile(`^(?i)(none|null|nil|undefined|true|false|redacted|your[_\-a-z]*|xxx+|\*+|\.+)$`),
+}
+
+// IsPlaceholder reports whether a configuration value is an obvious placeholder
+// or a reference to a value stored elsewhere, rather than a literal secret.
+func IsPlaceholder(value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return true
+	}
+	for _, r := range placeholderRegexes {
+		if r.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k KeyValueSignature) Match(pair KeyValuePair) (bool, error) {
+	if IsPlaceholder(pair.Value) {
+		return false, nil
+	}
+	matched, err := matchPattern(k.KeyMatchOn, pair.Key)
+	if err != nil || !matched || k.ValueMatchOn == "" {
+		return matched, err
+	}
+	return matchPattern(k.ValueMatchOn, pair.Value)
+}
+
+func (k KeyValueSignature) GetDescription() string {
+	return k.Description
+}
+
+func (k KeyValueSignature) GetComment() string {
+	return k.Comment
+}
+
+func (k KeyValueSignature) GetID() string {
+	return k.ID
+}
+
+func (k KeyValueSignature) GetSeverity() string {
+	return k.Severity
+}
+
+func (k KeyValueSignature) GetConfidence() string {
+	return k.Confidence
+}
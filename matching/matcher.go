@@ -0,0 +1,239 @@
+package matching
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Matcher is a detector that the analysis loop runs on files. The signature
+// types are matchers, and detectors that need code rather than a regular
+// expression, such as checksum validation, are registered with
+// RegisterMatcher.
+type Matcher interface {
+	// Name identifies the matcher in logs and in -disable-signature.
+	Name() string
+	// Match returns what the matcher found in the file. It may return matches
+	// together with an error when only part of the file couldn't be matched.
+	Match(file *File) ([]Match, error)
+}
+
+// Inspector is a matcher that also looks at what the other matchers found
+// before it becomes a finding, such as key inspection and verification. Its
+// Match may report nothing of its own.
+type Inspector interface {
+	Matcher
+	// Inspect adds to a match of the file. It is called for matches that
+	// aren't suppressed, with Locations holding the reported occurrence only
+	// and Text the matched text.
+	Inspect(file *File, match *Match) error
+}
+
+// Match is something a matcher found in a file, which the analysis loop
+// turns into a finding.
+type Match struct {
+	// FileSignature is reported as the file signature of the finding. When
+	// nil, the file signature that selected the file in mode 2 is used.
+	FileSignature Signature
+	// ContentSignature is reported as the content signature of the finding.
+	ContentSignature Signature
+	// Content is the text that Locations point into, which is the content of
+	// the file or a blob decoded from it.
+	Content string
+	// Locations are the start and end offsets of every occurrence. The first
+	// occurrence without a gitrob:allow annotation is reported.
+	Locations [][]int
+	// Text is the matched text when there are no Locations.
+	Text          string
+	EncodingChain []string
+	ConfigKey     string
+	Verifier      string
+	JWT           *JWTMetadata
+	// Category is CategorySecret when empty.
+	Category string
+	// RedactedValue is shown instead of the matched value, which is never
+	// stored for PII.
+	RedactedValue string
+	// KeyMetadata describes the key material of key files and key blocks.
+	KeyMetadata *KeyMetadata
+	// VerificationStatus is set when the secret was checked with the
+	// Verifier.
+	VerificationStatus string
+}
+
+// File is the file given to matchers. Its content and the blobs decoded from
+// it are read on first use, so matchers looking at the path only are cheap.
+type File struct {
+	Target MatchTarget
+	// FileSignature is the file signature that selected the file for content
+	// matching in mode 2.
+	FileSignature *FileSignature
+
+	decodeDepth int
+	read        func() (string, error)
+	content     *string
+	err         error
+	contents    []DecodedContent
+	readBlob    func() ([]byte, error)
+	blob        []byte
+	blobErr     error
+	blobRead    bool
+}
+
+// NewFile returns a file that reads its text content with read and its raw
+// bytes with readBlob.
+func NewFile(target MatchTarget, read func() (string, error), readBlob func() ([]byte, error), decodeDepth int) *File {
+	return &File{Target: target, read: read, readBlob: readBlob, decodeDepth: decodeDepth}
+}
+
+// Content returns the content of the file.
+func (f *File) Content() (string, error) {
+	if f.content == nil && f.err == nil {
+		content, err := f.read()
+		f.content, f.err = &content, err
+	}
+	if f.err != nil {
+		return "", f.err
+	}
+	return *f.content, nil
+}
+
+// Blob returns the raw bytes of the file, which Content leaves empty for
+// binary files such as keystores.
+func (f *File) Blob() ([]byte, error) {
+	if !f.blobRead {
+		f.blob, f.blobErr = f.readBlob()
+		f.blobRead = true
+	}
+	return f.blob, f.blobErr
+}
+
+// Contents returns the content of the file followed by the blobs decoded from
+// it, up to the decode depth.
+func (f *File) Contents() ([]DecodedContent, error) {
+	if f.contents != nil {
+		return f.contents, nil
+	}
+	content, err := f.Content()
+	if err != nil {
+		return nil, err
+	}
+	f.contents = append([]DecodedContent{{Content: content}}, DecodeContent(content, f.decodeDepth)...)
+	return f.contents, nil
+}
+
+// Matchers holds the matchers of a scan. File matchers run on every file,
+// content matchers on the files selected for content matching by the mode,
+// and inspectors, in order, on the matches of both.
+type Matchers struct {
+	File       []Matcher
+	Content    []Matcher
+	Inspectors []Inspector
+}
+
+// builtinMatchers are the names of the matchers of the signature types.
+var builtinMatchers = []string{"composite-signatures", "content-signatures", "file-signatures", "key-value-signatures"}
+
+var (
+	registryMutex sync.Mutex
+	registry      = make(map[string]Matcher)
+)
+
+// RegisterMatcher adds a matcher to the content matchers of every scan, or an
+// Inspector to the inspectors. It is meant to be called from the init
+// function of a file compiled into gitrob and panics when the name is empty
+// or already registered.
+func RegisterMatcher(matcher Matcher) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	name := matcher.Name()
+	if name == "" {
+		panic("matching: RegisterMatcher with an empty name")
+	}
+	if _, ok := registry[name]; ok || IsBuiltinMatcher(name) {
+		panic(fmt.Sprintf("matching: RegisterMatcher called twice for %s", name))
+	}
+	registry[name] = matcher
+}
+
+// RegisteredMatchers returns the registered matchers sorted by name.
+func RegisteredMatchers() []Matcher {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	var matchers []Matcher
+	for _, matcher := range registry {
+		matchers = append(matchers, matcher)
+	}
+	sort.Slice(matchers, func(i, j int) bool {
+		return matchers[i].Name() < matchers[j].Name()
+	})
+	return matchers
+}
+
+// IsBuiltinMatcher reports whether the name is that of the matcher of a
+// signature type or of a PII matcher.
+func IsBuiltinMatcher(name string) bool {
+	for _, builtin := range builtinMatchers {
+		if name == builtin {
+			return true
+		}
+	}
+	for _, matcher := range PIIMatchers() {
+		if matcher.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMatcher reports whether a built-in or registered matcher has the name, so
+// that -disable-signature takes it.
+func IsMatcher(name string) bool {
+	if IsBuiltinMatcher(name) {
+		return true
+	}
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	_, ok := registry[name]
+	return ok
+}
+
+// NewMatchers returns the matchers for the signatures and mode, followed by
+// the registered matchers, that aren't disabled. Mode 4 only runs the PII
+// matchers.
+func NewMatchers(signatures *Signatures, mode int, disabled []string) Matchers {
+	skip := make(map[string]bool)
+	for _, name := range disabled {
+		skip[name] = true
+	}
+	var matchers Matchers
+	add := func(list *[]Matcher, matcher Matcher) {
+		if !skip[matcher.Name()] {
+			*list = append(*list, matcher)
+		}
+	}
+	if mode == ModePII {
+		for _, matcher := range PIIMatchers() {
+			add(&matchers.Content, matcher)
+		}
+		return matchers
+	}
+	add(&matchers.File, compositeSignatureMatcher{signatures})
+	if mode == ModeFileMatch {
+		add(&matchers.File, fileSignatureMatcher{signatures})
+	} else {
+		add(&matchers.Content, contentSignatureMatcher{signatures})
+		add(&matchers.Content, keyValueSignatureMatcher{signatures})
+	}
+	for _, matcher := range RegisteredMatchers() {
+		if skip[matcher.Name()] {
+			continue
+		}
+		if inspector, ok := matcher.(Inspector); ok {
+			matchers.Inspectors = append(matchers.Inspectors, inspector)
+		} else if mode != ModeFileMatch {
+			matchers.Content = append(matchers.Content, matcher)
+		}
+	}
+	return matchers
+}
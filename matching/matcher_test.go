@@ -0,0 +1,131 @@
+package matching
+
+import (
+	"reflect"
+	"testing"
+)
+
+func matcherNames(matchers []Matcher) []string {
+	var names []string
+	for _, matcher := range matchers {
+		names = append(names, matcher.Name())
+	}
+	return names
+}
+
+func TestNewMatchers(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           int
+		disabled       []string
+		wantFile       []string
+		wantContent    []string
+		wantInspectors []string
+	}{
+		{
+			name:           "mode 1",
+			mode:           ModeFileMatch,
+			wantFile:       []string{"composite-signatures", "file-signatures"},
+			wantInspectors: []string{"keys"},
+		},
+		{
+			name:           "mode 3",
+			mode:           ModeContentMatch,
+			wantFile:       []string{"composite-signatures"},
+			wantContent:    []string{"content-signatures", "key-value-signatures", "jwt"},
+			wantInspectors: []string{"keys"},
+		},
+		{
+			name:        "disabled built-in matchers",
+			mode:        ModeContentMatch,
+			disabled:    []string{"content-signatures", "composite-signatures", "keys"},
+			wantContent: []string{"key-value-signatures", "jwt"},
+		},
+		{
+			name:        "mode 4",
+			mode:        ModePII,
+			disabled:    []string{"pii-email-dump"},
+			wantContent: []string{"pii-card-number", "pii-iban", "pii-us-ssn", "pii-uk-nino"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matchers := NewMatchers(&Signatures{}, test.mode, test.disabled)
+			var inspectors []string
+			for _, inspector := range matchers.Inspectors {
+				inspectors = append(inspectors, inspector.Name())
+			}
+			if got := matcherNames(matchers.File); !reflect.DeepEqual(got, test.wantFile) {
+				t.Errorf("file matchers = %q, want %q", got, test.wantFile)
+			}
+			if got := matcherNames(matchers.Content); !reflect.DeepEqual(got, test.wantContent) {
+				t.Errorf("content matchers = %q, want %q", got, test.wantContent)
+			}
+			if !reflect.DeepEqual(inspectors, test.wantInspectors) {
+				t.Errorf("inspectors = %q, want %q", inspectors, test.wantInspectors)
+			}
+		})
+	}
+}
+
+func TestIsMatcher(t *testing.T) {
+	for name, want := range map[string]bool{
+		"file-signatures":    true,
+		"content-signatures": true,
+		"jwt":                true,
+		"keys":               true,
+		"pii-iban":           true,
+		"aws-access-key-id":  false,
+	} {
+		if got := IsMatcher(name); got != want {
+			t.Errorf("IsMatcher(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestKeyInspector(t *testing.T) {
+	keys := generateKeys(t)
+	blob := func(data string) func() ([]byte, error) {
+		return func() ([]byte, error) { return []byte(data), nil }
+	}
+	tests := []struct {
+		name  string
+		file  *File
+		match Match
+		want  *KeyMetadata
+	}{
+		{
+			name:  "file match of a key file",
+			file:  NewFile(NewMatchTarget("deploy/id_rsa"), nil, blob(keys.public), 0),
+			match: Match{FileSignature: FileSignature{ID: "private-ssh-key"}},
+			want:  &KeyMetadata{Format: KeyFormatPEM, Type: "PUBLIC KEY", Valid: true},
+		},
+		{
+			name:  "file match of another file",
+			file:  NewFile(NewMatchTarget("config/database.yml"), nil, blob(keys.private), 0),
+			match: Match{FileSignature: FileSignature{ID: "database-config"}},
+		},
+		{
+			name: "content match of a key block",
+			file: NewFile(NewMatchTarget("src/config.js"), nil, blob(""), 0),
+			match: Match{ContentSignature: ContentSignature{ID: "ssh-private-key"}, Content: keys.private,
+				Locations: [][]int{{5, 22}}},
+			want: &KeyMetadata{Format: KeyFormatPEM, Type: "PRIVATE KEY", Private: true, Valid: true},
+		},
+		{
+			name: "content match of something else in a key file",
+			file: NewFile(NewMatchTarget("server.pem"), nil, blob(keys.public), 0),
+			match: Match{ContentSignature: ContentSignature{ID: "generic-secret"}, Content: "secret = hunter2",
+				Locations: [][]int{{9, 16}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match := test.match
+			if err := (keyInspector{}).Inspect(test.file, &match); err != nil {
+				t.Fatal(err)
+			}
+			assertKeyMetadata(t, match.KeyMetadata, test.want)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package matching
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MatchFile returns the first file signature matching the target.
+func (s *Signatures) MatchFile(target MatchTarget) (*FileSignature, error) {
+	for i := range s.FileSignatures {
+		matched, err := s.FileSignatures[i].Match(target)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", s.FileSignatures[i].ID, err)
+		}
+		if matched {
+			return &s.FileSignatures[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// fileSignatureMatcher reports the first matching file signature.
+type fileSignatureMatcher struct {
+	signatures *Signatures
+}
+
+func (fileSignatureMatcher) Name() string {
+	return "file-signatures"
+}
+
+func (m fileSignatureMatcher) Match(file *File) ([]Match, error) {
+	signature, err := m.signatures.MatchFile(file.Target)
+	if signature == nil {
+		return nil, err
+	}
+	return []Match{{FileSignature: *signature}}, nil
+}
+
+// contentSignatureMatcher reports every content signature matching the
+// content or a blob decoded from it, once per file.
+type contentSignatureMatcher struct {
+	signatures *Signatures
+}
+
+func (contentSignatureMatcher) Name() string {
+	return "content-signatures"
+}
+
+func (m contentSignatureMatcher) Match(file *File) ([]Match, error) {
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	var matches []Match
+	var errs []string
+	matched := make([]bool, len(m.signatures.ContentSignatures))
+	for _, content := range contents {
+		target := file.Target
+		target.Content = content.Content
+		candidates := m.signatures.ContentCandidates(content.Content)
+		for i, signature := range m.signatures.ContentSignatures {
+			if matched[i] || !candidates[i] || !signature.AppliesTo(target) {
+				continue
+			}
+			locs, err := signature.FindAllIndex(target)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", signature.ID, err))
+			}
+			if len(locs) == 0 {
+				continue
+			}
+			matched[i] = true
+			matches = append(matches, Match{
+				ContentSignature: signature,
+				Content:          content.Content,
+				Locations:        locs,
+				EncodingChain:    content.EncodingChain,
+				Verifier:         signature.Verifier,
+			})
+		}
+	}
+	return matches, joinErrors(errs)
+}
+
+// keyValueSignatureMatcher reports every key/value signature matching a pair
+// of a configuration file, once per file.
+type keyValueSignatureMatcher struct {
+	signatures *Signatures
+}
+
+func (keyValueSignatureMatcher) Name() string {
+	return "key-value-signatures"
+}
+
+func (m keyValueSignatureMatcher) Match(file *File) ([]Match, error) {
+	if len(m.signatures.KeyValueSignatures) == 0 || !IsConfigFile(file.Target.Filename) {
+		return nil, nil
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	var matches []Match
+	var errs []string
+	matched := make([]bool, len(m.signatures.KeyValueSignatures))
+	for _, content := range contents {
+		for _, pair := range ExtractKeyValues(file.Target.Filename, content.Content) {
+			for i, signature := range m.signatures.KeyValueSignatures {
+				if matched[i] {
+					continue
+				}
+				ok, err := signature.Match(pair)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %s", signature.ID, err))
+				}
+				if !ok {
+					continue
+				}
+				matched[i] = true
+				matches = append(matches, Match{
+					ContentSignature: signature,
+					Content:          content.Content,
+					Locations:        locatePair(content.Content, pair),
+					Text:             pair.Value,
+					EncodingChain:    content.EncodingChain,
+					ConfigKey:        pair.Key,
+					Verifier:         signature.Verifier,
+				})
+			}
+		}
+	}
+	return matches, joinErrors(errs)
+}
+
+// locatePair finds the first occurrence of the value of the pair in the
+// content, or of its key when the value is empty. Values that were unquoted
+// or unescaped by the parser may not be found.
+func locatePair(content string, pair KeyValuePair) [][]int {
+	needle := pair.Value
+	if needle == "" {
+		needle = pair.Key
+	}
+	offset := strings.Index(content, needle)
+	if offset == -1 {
+		return nil
+	}
+	return [][]int{{offset, offset + len(needle)}}
+}
+
+// compositeSignatureMatcher reports every matching composite signature. Those
+// with content conditions are reported as content signatures at the locations
+// of their content patterns, the others as file signatures.
+type compositeSignatureMatcher struct {
+	signatures *Signatures
+}
+
+func (compositeSignatureMatcher) Name() string {
+	return "composite-signatures"
+}
+
+func (m compositeSignatureMatcher) Match(file *File) ([]Match, error) {
+	var matches []Match
+	var errs []string
+	for _, signature := range m.signatures.CompositeSignatures {
+		matched, err := signature.Match(file.Target, file.Content)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", signature.ID, err))
+		}
+		if !matched {
+			continue
+		}
+		if signature.Condition.UsesContent() {
+			content, err := file.Content()
+			if err != nil {
+				return matches, err
+			}
+			locations, err := signature.Condition.Locate(content)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", signature.ID, err))
+			}
+			matches = append(matches, Match{FileSignature: FileSignature{Description: "NA"}, ContentSignature: signature,
+				Content: content, Locations: locations})
+		} else {
+			matches = append(matches, Match{FileSignature: signature})
+		}
+	}
+	return matches, joinErrors(errs)
+}
+
+func joinErrors(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(errs, "; "))
+}
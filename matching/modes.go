@@ -4,4 +4,5 @@ const (
 	ModeFileMatch = iota + 1
 	ModeMixed
 	ModeContentMatch
+	ModePII
 )
@@ -0,0 +1,283 @@
+package matching
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	CategorySecret = "secret"
+	CategoryPII    = "pii"
+)
+
+// emailDumpThreshold is the number of distinct email addresses above which a
+// file is reported as an email address dump.
+const emailDumpThreshold = 20
+
+var (
+	cardNumberRegex = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	ibanRegex       = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`)
+	usSSNRegex      = regexp.MustCompile(`\b(\d{3})-(\d{2})-(\d{4})\b`)
+	ukNINORegex     = regexp.MustCompile(`\b([A-CEGHJ-PR-TW-Z]{2}) ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`)
+	emailRegex      = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@([A-Za-z0-9-]+\.)+[A-Za-z]{2,}\b`)
+)
+
+// testCardNumbers are numbers published by payment processors for testing,
+// which are reported with a low confidence.
+var testCardNumbers = map[string]bool{
+	"4111111111111111": true, "4242424242424242": true, "4012888888881881": true, "4000056655665556": true,
+	"5555555555554444": true, "5105105105105100": true, "5200828282828210": true, "2223003122003222": true,
+	"378282246310005": true, "371449635398431": true, "6011111111111117": true, "6011000990139424": true,
+	"3530111333300000": true, "30569309025904": true, "38520000023237": true,
+}
+
+// ibanLengths maps the country codes of IBAN countries to the length of
+// their IBANs.
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BR": 29, "CH": 21, "CR": 22,
+	"CY": 28, "CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "ES": 24, "FI": 18, "FO": 18, "FR": 27, "GB": 22,
+	"GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IS": 26, "IT": 27,
+	"JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22,
+	"MK": 19, "MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29,
+	"RO": 24, "RS": 22, "SA": 24, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "TN": 24, "TR": 26, "UA": 29, "VG": 24,
+	"XK": 20,
+}
+
+// exampleEmailDomains are not counted towards email address dumps.
+var exampleEmailDomains = []string{"example.com", "example.org", "example.net", "test.com", "localhost"}
+
+var (
+	cardNumberSignature = ContentSignature{ID: "pii-card-number", Severity: SeverityHigh, Confidence: ConfidenceMedium,
+		Description: "Payment card number", Comment: "The number passes the Luhn check and has the prefix of a card network."}
+	ibanSignature = ContentSignature{ID: "pii-iban", Severity: SeverityMedium, Confidence: ConfidenceHigh,
+		Description: "IBAN", Comment: "The number has the length of its country and a valid checksum."}
+	usSSNSignature = ContentSignature{ID: "pii-us-ssn", Severity: SeverityHigh, Confidence: ConfidenceMedium,
+		Description: "US Social Security number", Comment: ""}
+	ukNINOSignature = ContentSignature{ID: "pii-uk-nino", Severity: SeverityHigh, Confidence: ConfidenceMedium,
+		Description: "UK National Insurance number", Comment: ""}
+	emailDumpSignature = ContentSignature{ID: "pii-email-dump", Severity: SeverityMedium, Confidence: ConfidenceMedium,
+		Description: "Email address dump", Comment: fmt.Sprintf("The file holds more than %d distinct email addresses.",
+			emailDumpThreshold)}
+)
+
+// PIIMatchers returns the matchers of mode 4.
+func PIIMatchers() []Matcher {
+	return []Matcher{
+		piiMatcher{cardNumberSignature, cardNumberRegex, parseCardNumber, redactCardNumber},
+		piiMatcher{ibanSignature, ibanRegex, parseIBAN, redactIBAN},
+		piiMatcher{usSSNSignature, usSSNRegex, parseUSSSN, redactNationalID},
+		piiMatcher{ukNINOSignature, ukNINORegex, parseUKNINO, redactNationalID},
+		emailDumpMatcher{},
+	}
+}
+
+// piiMatcher reports every distinct value matching the pattern that passes
+// the validation, redacted. The validation returns the value without the
+// spaces and dashes that group its characters.
+type piiMatcher struct {
+	signature ContentSignature
+	pattern   *regexp.Regexp
+	validate  func(match string) (string, bool)
+	redact    func(value string) string
+}
+
+func (m piiMatcher) Name() string {
+	return m.signature.ID
+}
+
+func (m piiMatcher) Match(file *File) ([]Match, error) {
+	content, err := file.Content()
+	if err != nil {
+		return nil, err
+	}
+	locations := make(map[string][][]int)
+	var values []string
+	for _, loc := range m.pattern.FindAllStringIndex(content, -1) {
+		value, ok := m.validate(content[loc[0]:loc[1]])
+		if !ok {
+			continue
+		}
+		if _, ok := locations[value]; !ok {
+			values = append(values, value)
+		}
+		locations[value] = append(locations[value], loc)
+	}
+	var matches []Match
+	for _, value := range values {
+		signature := m.signature
+		if m.signature.ID == cardNumberSignature.ID && testCardNumbers[value] {
+			signature.Confidence = ConfidenceLow
+			signature.Comment = "A well-known test card number."
+		}
+		matches = append(matches, Match{
+			ContentSignature: signature,
+			Content:          content,
+			Locations:        locations[value],
+			Category:         CategoryPII,
+			RedactedValue:    m.redact(value),
+		})
+	}
+	return matches, nil
+}
+
+// normalizePII removes the spaces and dashes that group digits.
+func normalizePII(value string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(value)
+}
+
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func parseCardNumber(match string) (string, bool) {
+	number := normalizePII(match)
+	if len(number) < 13 || len(number) > 19 || strings.Count(number, number[:1]) == len(number) {
+		return "", false
+	}
+	prefix2, prefix4 := number[:2], number[:4]
+	switch {
+	case number[0] == '4':
+	case prefix2 >= "51" && prefix2 <= "55", prefix4 >= "2221" && prefix4 <= "2720":
+	case prefix2 == "34", prefix2 == "37":
+	case prefix4 == "6011", prefix2 == "65":
+	case prefix2 == "35", prefix2 == "36", prefix2 == "38", number[:3] >= "300" && number[:3] <= "305":
+	default:
+		return "", false
+	}
+	return number, luhn(number)
+}
+
+// parseIBAN cuts the match to the length of IBANs of its country, since the
+// pattern can run into an uppercase word that follows the IBAN.
+func parseIBAN(match string) (string, bool) {
+	iban := normalizePII(match)
+	length, ok := ibanLengths[iban[:2]]
+	if !ok || len(iban) < length {
+		return "", false
+	}
+	iban = iban[:length]
+	var digits strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return iban, ok && n.Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+func parseUSSSN(match string) (string, bool) {
+	ssn := normalizePII(match)
+	area, group, serial := ssn[:3], ssn[3:5], ssn[5:]
+	return ssn, area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000" &&
+		ssn != "123456789" && ssn != "078051120"
+}
+
+func parseUKNINO(match string) (string, bool) {
+	nino := normalizePII(match)
+	switch nino[:2] {
+	case "BG", "GB", "NK", "KN", "TN", "NT", "ZZ":
+		return "", false
+	}
+	return nino, nino[1] != 'O'
+}
+
+func redactCardNumber(number string) string {
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
+
+func redactIBAN(iban string) string {
+	return iban[:2] + strings.Repeat("*", len(iban)-6) + iban[len(iban)-4:]
+}
+
+func redactNationalID(id string) string {
+	return strings.Repeat("*", len(id)-3) + id[len(id)-3:]
+}
+
+// RedactEmail keeps the first character of the local part and the domain.
+func RedactEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// RedactEmails redacts every email address in the text.
+func RedactEmails(text string) string {
+	return emailRegex.ReplaceAllStringFunc(text, RedactEmail)
+}
+
+// emailDumpMatcher reports files holding many distinct email addresses, such
+// as exported user tables, rather than every address.
+type emailDumpMatcher struct{}
+
+func (emailDumpMatcher) Name() string {
+	return emailDumpSignature.ID
+}
+
+func (emailDumpMatcher) Match(file *File) ([]Match, error) {
+	content, err := file.Content()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var locations [][]int
+	for _, loc := range emailRegex.FindAllStringIndex(content, -1) {
+		email := strings.ToLower(content[loc[0]:loc[1]])
+		if seen[email] || isExampleEmail(email) {
+			continue
+		}
+		seen[email] = true
+		locations = append(locations, loc)
+	}
+	if len(seen) <= emailDumpThreshold {
+		return nil, nil
+	}
+	redacted := make(map[string]bool)
+	for email := range seen {
+		redacted[RedactEmail(email)] = true
+	}
+	var samples []string
+	for sample := range redacted {
+		samples = append(samples, sample)
+	}
+	sort.Strings(samples)
+	if len(samples) > 3 {
+		samples = samples[:3]
+	}
+	return []Match{{
+		ContentSignature: emailDumpSignature,
+		Content:          content,
+		Locations:        locations[:1],
+		Category:         CategoryPII,
+		RedactedValue:    fmt.Sprintf("%d addresses, e.g. %s", len(seen), strings.Join(samples, ", ")),
+	}}, nil
+}
+
+func isExampleEmail(email string) bool {
+	for _, domain := range exampleEmailDomains {
+		if strings.HasSuffix(email, "@"+domain) || strings.HasSuffix(email, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package matching
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLuhn(t *testing.T) {
+	tests := map[string]bool{
+		"4111111111111111": true,
+		"4111111111111112": false,
+		"79927398713":      true,
+		"79927398710":      false,
+		"0":                true,
+	}
+	for digits, want := range tests {
+		if got := luhn(digits); got != want {
+			t.Errorf("luhn(%q) = %v, want %v", digits, got, want)
+		}
+	}
+}
+
+func TestParsePII(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(string) (string, bool)
+		match string
+		want  string
+		ok    bool
+	}{
+		{"card number with spaces", parseCardNumber, "4111 1111 1111 1111", "4111111111111111", true},
+		{"card number with dashes", parseCardNumber, "5555-5555-5555-4444", "5555555555554444", true},
+		{"card number failing Luhn", parseCardNumber, "4111111111111112", "4111111111111112", false},
+		{"card number of an unknown network", parseCardNumber, "9111111111111111", "", false},
+		{"repeated digit", parseCardNumber, "0000000000000000", "", false},
+		{"IBAN", parseIBAN, "GB82 WEST 1234 5698 7654 32", "GB82WEST12345698765432", true},
+		{"IBAN followed by a word", parseIBAN, "DE89370400440532013000 ABC", "DE89370400440532013000", true},
+		{"IBAN with a wrong checksum", parseIBAN, "GB83WEST12345698765432", "GB83WEST12345698765432", false},
+		{"IBAN of an unknown country", parseIBAN, "XX82WEST12345698765432", "", false},
+		{"IBAN that is too short", parseIBAN, "GB82WEST123456", "", false},
+		{"SSN", parseUSSSN, "123-45-6780", "123456780", true},
+		{"SSN with area 000", parseUSSSN, "000-45-6789", "000456789", false},
+		{"SSN with area 666", parseUSSSN, "666-45-6789", "666456789", false},
+		{"SSN with area 9xx", parseUSSSN, "912-45-6789", "912456789", false},
+		{"SSN with group 00", parseUSSSN, "123-00-6789", "123000789", false},
+		{"SSN with serial 0000", parseUSSSN, "123-45-0000", "123450000", false},
+		{"advertised SSN", parseUSSSN, "078-05-1120", "078051120", false},
+		{"NINO", parseUKNINO, "AB 12 34 56 C", "AB123456C", true},
+		{"NINO with an invalid prefix", parseUKNINO, "GB123456C", "", false},
+		{"NINO with O as second letter", parseUKNINO, "AO123456C", "AO123456C", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.parse(test.match)
+			if ok != test.ok || (ok && got != test.want) {
+				t.Errorf("parse(%q) = %q, %v, want %q, %v", test.match, got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestRedactPII(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{redactCardNumber("4111111111111111"), "************1111"},
+		{redactIBAN("GB82WEST12345698765432"), "GB****************5432"},
+		{redactNationalID("123456780"), "******780"},
+		{RedactEmail("jane.doe@corp.example"), "j***@corp.example"},
+		{RedactEmail("@corp.example"), "***"},
+		{RedactEmails("from jane@corp.example to joe@corp.example"), "from j***@corp.example to j***@corp.example"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("redacted %q, want %q", test.got, test.want)
+		}
+	}
+}
+
+func TestPIIMatchers(t *testing.T) {
+	var emails []string
+	for i := 0; i <= emailDumpThreshold; i++ {
+		emails = append(emails, fmt.Sprintf("user%d@corp.example", i))
+	}
+	content := strings.Join([]string{
+		"card: 4111 1111 1111 1111",
+		"card again: 4111-1111-1111-1111",
+		"card: 4000 0000 0000 0002",
+		"iban: DE89 3704 0044 0532 0130 00",
+		"ssn: 123-45-6780, order: 123-45-0000",
+		"nino: AB123456C",
+		strings.Join(emails, ","),
+		"admin@example.com",
+	}, "\n")
+	file := NewFile(NewMatchTarget("export/customers.csv"), func() (string, error) { return content, nil }, nil, 0)
+	want := map[string][]string{
+		"pii-card-number": {"************1111", "************0002"},
+		"pii-iban":        {"DE****************3000"},
+		"pii-us-ssn":      {"******780"},
+		"pii-uk-nino":     {"******56C"},
+		"pii-email-dump":  {fmt.Sprintf("%d addresses, e.g. u***@corp.example", emailDumpThreshold+1)},
+	}
+	for _, matcher := range PIIMatchers() {
+		matches, err := matcher.Match(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, match := range matches {
+			if match.Category != CategoryPII {
+				t.Errorf("%s: category = %q, want %q", matcher.Name(), match.Category, CategoryPII)
+			}
+			got = append(got, match.RedactedValue)
+		}
+		if strings.Join(got, "|") != strings.Join(want[matcher.Name()], "|") {
+			t.Errorf("%s: redacted values = %q, want %q", matcher.Name(), got, want[matcher.Name()])
+		}
+	}
+}
+
+func TestPIIFingerprint(t *testing.T) {
+	key := []byte("fingerprint key")
+	finding := &Finding{RepositoryOwner: "acme", RepositoryName: "crm", FilePath: "export/customers.csv",
+		ContentSignatureID: "pii-us-ssn", Category: CategoryPII, RedactedValue: "******780"}
+	fingerprint := func(value string, key []byte) string {
+		t.Helper()
+		fingerprint, err := finding.GenerateFingerprint(value, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fingerprint
+	}
+	first := fingerprint("123456780", key)
+	if second := fingerprint("223456780", key); first == second {
+		t.Errorf("fingerprints of PII with the same redacted value are equal: %s", first)
+	}
+	if again := fingerprint("123456780", key); first != again {
+		t.Errorf("fingerprints of the same PII differ: %s, %s", first, again)
+	}
+	if other := fingerprint("123456780", []byte("other key")); first == other {
+		t.Errorf("fingerprints of PII under different keys are equal: %s", first)
+	}
+	if _, err := finding.GenerateFingerprint("123456780", nil); err == nil {
+		t.Error("fingerprinting PII without a key succeeded, want an error")
+	}
+
+	finding.Category = CategorySecret
+	if secret, other := fingerprint("123456780", nil), fingerprint("223456780", nil); secret == other {
+		t.Errorf("fingerprints of different secrets are equal: %s", secret)
+	}
+	if withKey, withoutKey := fingerprint("123456780", key), fingerprint("123456780", nil); withKey != withoutKey {
+		t.Errorf("the key changed the fingerprint of a secret: %s, %s", withKey, withoutKey)
+	}
+}
+
+func TestEmailDumpFingerprint(t *testing.T) {
+	key := []byte("fingerprint key")
+	fingerprint := func(addresses int) string {
+		t.Helper()
+		var emails []string
+		for i := 0; i < addresses; i++ {
+			emails = append(emails, fmt.Sprintf("user%d@corp.example", i))
+		}
+		content := strings.Join(emails, "\n")
+		file := NewFile(NewMatchTarget("export/users.csv"), func() (string, error) { return content, nil }, nil, 0)
+		matches, err := emailDumpMatcher{}.Match(file)
+		if err != nil || len(matches) != 1 {
+			t.Fatalf("got %d matches and error %v, want one email dump", len(matches), err)
+		}
+		match := matches[0]
+		finding := &Finding{FilePath: "export/users.csv", ContentSignatureID: "pii-email-dump", Category: CategoryPII,
+			RedactedValue: match.RedactedValue}
+		loc := match.Locations[0]
+		fingerprint, err := finding.GenerateFingerprint(match.Content[loc[0]:loc[1]], key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fingerprint
+	}
+	if before, after := fingerprint(emailDumpThreshold+1), fingerprint(emailDumpThreshold+5); before != after {
+		t.Errorf("adding addresses to a dump changed its fingerprint: %s, %s", before, after)
+	}
+}
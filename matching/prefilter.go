@@ -0,0 +1,130 @@
+package matching
+
+import "strings"
+
+// Prefilter finds the keywords of all content signatures in a single pass
+// over the content with an Aho-Corasick automaton, so that the regular
+// expression of a signature only runs on content containing one of its
+// keywords. Keywords are matched case-insensitively in ASCII only: the
+// automaton works on bytes, so other letters, such as É and é, must be given
+// in each case that should match.
+type Prefilter struct {
+	delta      [][256]int32
+	outputs    [][]int
+	always     []bool
+	signatures int
+	keyworded  int
+}
+
+// NewPrefilter builds the automaton for the keywords of the signatures.
+func NewPrefilter(signatures []ContentSignature) *Prefilter {
+	p := &Prefilter{
+		delta:      make([][256]int32, 1),
+		outputs:    make([][]int, 1),
+		always:     make([]bool, len(signatures)),
+		signatures: len(signatures),
+	}
+	for i, sig := range signatures {
+		if len(sig.Keywords) == 0 {
+			p.always[i] = true
+			continue
+		}
+		p.keyworded++
+		for _, keyword := range sig.Keywords {
+			p.add(foldASCII(keyword), i)
+		}
+	}
+	p.link()
+	return p
+}
+
+// add inserts a keyword into the trie. Missing transitions are 0 until link
+// turns the trie into a complete automaton.
+func (p *Prefilter) add(keyword string, signature int) {
+	state := int32(0)
+	for i := 0; i < len(keyword); i++ {
+		next := p.delta[state][keyword[i]]
+		if next == 0 {
+			p.delta = append(p.delta, [256]int32{})
+			p.outputs = append(p.outputs, nil)
+			next = int32(len(p.delta) - 1)
+			p.delta[state][keyword[i]] = next
+		}
+		state = next
+	}
+	p.outputs[state] = append(p.outputs[state], signature)
+}
+
+// link computes the failure links breadth first and fills in every missing
+// transition with the transition of the failure state.
+func (p *Prefilter) link() {
+	fail := make([]int32, len(p.delta))
+	var queue []int32
+	for c := 0; c < 256; c++ {
+		if next := p.delta[0][c]; next != 0 {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		p.outputs[state] = append(p.outputs[state], p.outputs[fail[state]]...)
+		for c := 0; c < 256; c++ {
+			next := p.delta[state][c]
+			if next == 0 {
+				p.delta[state][c] = p.delta[fail[state]][c]
+				continue
+			}
+			fail[next] = p.delta[fail[state]][c]
+			queue = append(queue, next)
+		}
+	}
+}
+
+// Candidates reports for each signature whether its regular expression
+// should run on the content: either it has no keywords or one of them occurs.
+func (p *Prefilter) Candidates(content string) []bool {
+	candidates := make([]bool, p.signatures)
+	copy(candidates, p.always)
+	remaining := p.keyworded
+	state := int32(0)
+	for i := 0; i < len(content) && remaining > 0; i++ {
+		c := content[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		state = p.delta[state][c]
+		for _, signature := range p.outputs[state] {
+			if !candidates[signature] {
+				candidates[signature] = true
+				remaining--
+			}
+		}
+	}
+	return candidates
+}
+
+// hasKeyword reports whether the content contains one of the keywords of the
+// signature, or whether the signature has none.
+func (c ContentSignature) hasKeyword(content string) bool {
+	if len(c.Keywords) == 0 {
+		return true
+	}
+	content = foldASCII(content)
+	for _, keyword := range c.Keywords {
+		if strings.Contains(content, foldASCII(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// foldASCII lowercases the ASCII letters of s, as the prefilter does.
+func foldASCII(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
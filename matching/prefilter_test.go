@@ -0,0 +1,56 @@
+package matching
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrefilterCandidates(t *testing.T) {
+	signatures := []ContentSignature{
+		{ID: "aws", Keywords: []string{"AKIA"}},
+		{ID: "slack", Keywords: []string{"xoxb", "xoxp"}},
+		{ID: "generic"},
+		{ID: "accented", Keywords: []string{"clé"}},
+	}
+	prefilter := NewPrefilter(signatures)
+	tests := []struct {
+		content string
+		want    []bool
+	}{
+		{"", []bool{false, false, true, false}},
+		{"aws_key = akiaIOSFODNN7EXAMPLE", []bool{true, false, true, false}},
+		{"token: XOXP-1234", []bool{false, true, true, false}},
+		{"xoxAKIAxoxb", []bool{true, true, true, false}},
+		{"CLÉ: secret", []bool{false, false, true, false}},
+		{"Clé: secret", []bool{false, false, true, true}},
+	}
+	for _, test := range tests {
+		got := prefilter.Candidates(test.content)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Candidates(%q) = %v, want %v", test.content, got, test.want)
+		}
+		for i, signature := range signatures {
+			if signature.hasKeyword(test.content) != test.want[i] {
+				t.Errorf("%s.hasKeyword(%q) = %v, want %v", signature.ID, test.content, !test.want[i], test.want[i])
+			}
+		}
+	}
+}
+
+func BenchmarkPrefilter(b *testing.B) {
+	DefaultSignatures = os.DirFS("..")
+	defer func() { DefaultSignatures = os.DirFS(".") }()
+	var signatures Signatures
+	if err := signatures.loadDefaults(); err != nil {
+		b.Fatal(err)
+	}
+	prefilter := NewPrefilter(signatures.ContentSignatures)
+	content := strings.Repeat("func main() {\n\tfmt.Println(\"Hello, World\", os.Args[1:])\n}\n", 2000)
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prefilter.Candidates(content)
+	}
+}
@@ -0,0 +1,118 @@
+package matching
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// fileTypes groups extensions under names that can be used in the FileTypes
+// of a content signature. Entries of FileTypes that start with a dot are
+// extensions themselves.
+var fileTypes = map[string][]string{
+	"c":          {".c", ".h", ".cc", ".cpp", ".cxx", ".hpp"},
+	"config":     {".env", ".yml", ".yaml", ".json", ".toml", ".ini", ".cfg", ".conf", ".properties", ".xml", ".config", ".tf", ".tfvars"},
+	"csharp":     {".cs", ".csx"},
+	"go":         {".go"},
+	"java":       {".java", ".kt", ".kts", ".scala", ".groovy", ".gradle"},
+	"javascript": {".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".vue"},
+	"notebook":   {".ipynb"},
+	"php":        {".php"},
+	"python":     {".py"},
+	"ruby":       {".rb", ".erb", ".rake"},
+	"shell":      {".sh", ".bash", ".zsh", ".ps1", ".bat", ".cmd"},
+	"text":       {".txt", ".md", ".rst", ".log"},
+}
+
+var globCache sync.Map
+
+// globToRegexp translates a glob into a regular expression. * and ? don't
+// match slashes, ** matches any number of directories, and a glob without a
+// slash matches the file name in any directory, like in .gitignore files.
+func globToRegexp(glob string) *regexp.Regexp {
+	if r, ok := globCache.Load(glob); ok {
+		return r.(*regexp.Regexp)
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	if !strings.Contains(glob, "/") {
+		b.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	r := regexp.MustCompile(b.String())
+	globCache.Store(glob, r)
+	return r
+}
+
+func MatchGlob(glob, path string) bool {
+	return globToRegexp(glob).MatchString(path)
+}
+
+func matchAnyGlob(globs []string, path string) bool {
+	for _, glob := range globs {
+		if MatchGlob(glob, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateFileTypes(types []string) error {
+	for _, fileType := range types {
+		if _, ok := fileTypes[fileType]; !ok && !strings.HasPrefix(fileType, ".") {
+			return fmt.Errorf("unknown file type %s", fileType)
+		}
+	}
+	return nil
+}
+
+func matchFileTypes(types []string, extension string) bool {
+	extension = strings.ToLower(extension)
+	for _, fileType := range types {
+		if strings.ToLower(fileType) == extension {
+			return true
+		}
+		for _, ext := range fileTypes[fileType] {
+			if ext == extension {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AppliesTo reports whether the signature should run on the content of the
+// target, given its IncludePaths, ExcludePaths and FileTypes.
+func (c ContentSignature) AppliesTo(target MatchTarget) bool {
+	if len(c.FileTypes) > 0 && !matchFileTypes(c.FileTypes, target.Extension) {
+		return false
+	}
+	if len(c.IncludePaths) > 0 && !matchAnyGlob(c.IncludePaths, target.Path) {
+		return false
+	}
+	return !matchAnyGlob(c.ExcludePaths, target.Path)
+}
+
+// IsContentExcluded reports whether content and key/value signatures should
+// skip the target altogether, which is the case for generated files such as
+// lockfiles and minified code.
+func (s *Signatures) IsContentExcluded(target MatchTarget) bool {
+	return matchAnyGlob(s.ContentExclusions, target.Path)
+}
@@ -0,0 +1,205 @@
+package matching
+
+import (
+	"encoding/json"
+	"fmt"
+	"gitrob/common"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+	SeverityInfo     = "info"
+
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
+var severityRanks = map[string]int{
+	SeverityInfo:     1,
+	SeverityLow:      2,
+	SeverityMedium:   3,
+	SeverityHigh:     4,
+	SeverityCritical: 5,
+}
+
+var confidenceRanks = map[string]int{
+	ConfidenceLow:    1,
+	ConfidenceMedium: 2,
+	ConfidenceHigh:   3,
+}
+
+// SeverityRank orders severities from info (1) to critical (5). Unknown and
+// empty severities rank 0.
+func SeverityRank(severity string) int {
+	return severityRanks[strings.ToLower(severity)]
+}
+
+// ConfidenceRank orders confidences from low (1) to high (3). Unknown and empty
+// confidences rank 0.
+func ConfidenceRank(confidence string) int {
+	return confidenceRanks[strings.ToLower(confidence)]
+}
+
+func ValidateSeverity(severity string) error {
+	if SeverityRank(severity) == 0 {
+		return fmt.Errorf("invalid severity %q, expected one of: critical, high, medium, low, info", severity)
+	}
+	return nil
+}
+
+func ValidateConfidence(confidence string) error {
+	if ConfidenceRank(confidence) == 0 {
+		return fmt.Errorf("invalid confidence %q, expected one of: high, medium, low", confidence)
+	}
+	return nil
+}
+
+// SeverityOverride replaces the severity and/or confidence of a signature.
+// Empty fields keep the value from the signature file.
+type SeverityOverride struct {
+	Severity   string
+	Confidence string
+}
+
+// LoadSeverityOverrides reads a JSON object that maps signature IDs to
+// overrides.
+func LoadSeverityOverrides(path string) (map[string]SeverityOverride, error) {
+	if !common.FileExists(path) {
+		return nil, fmt.Errorf("missing severity overrides file: %s", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]SeverityOverride)
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// matcherSignatureIDs are the IDs of the signatures that matchers build in
+// rather than load from signature files.
+func matcherSignatureIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, signature := range []ContentSignature{jwtSignature, cardNumberSignature, ibanSignature, usSSNSignature,
+		ukNINOSignature, emailDumpSignature} {
+		ids[signature.ID] = true
+	}
+	return ids
+}
+
+// ApplyOverrides changes the severity and confidence of the loaded signatures,
+// keeps the overrides of built-in matcher signatures for OverrideFinding and
+// returns the IDs of overrides that match neither, which happens for content
+// signatures in file matching mode.
+func (s *Signatures) ApplyOverrides(overrides map[string]SeverityOverride) ([]string, error) {
+	for id, override := range overrides {
+		if override.Severity != "" {
+			if err := ValidateSeverity(override.Severity); err != nil {
+				return nil, fmt.Errorf("%s: %s", id, err)
+			}
+		}
+		if override.Confidence != "" {
+			if err := ValidateConfidence(override.Confidence); err != nil {
+				return nil, fmt.Errorf("%s: %s", id, err)
+			}
+		}
+	}
+	applied := make(map[string]bool)
+	apply := func(id string, severity, confidence *string) {
+		if override, ok := overrides[id]; ok {
+			applied[id] = true
+			if override.Severity != "" {
+				*severity = strings.ToLower(override.Severity)
+			}
+			if override.Confidence != "" {
+				*confidence = strings.ToLower(override.Confidence)
+			}
+		}
+	}
+	for i := range s.FileSignatures {
+		apply(s.FileSignatures[i].ID, &s.FileSignatures[i].Severity, &s.FileSignatures[i].Confidence)
+	}
+	for i := range s.ContentSignatures {
+		apply(s.ContentSignatures[i].ID, &s.ContentSignatures[i].Severity, &s.ContentSignatures[i].Confidence)
+	}
+	for i := range s.KeyValueSignatures {
+		apply(s.KeyValueSignatures[i].ID, &s.KeyValueSignatures[i].Severity, &s.KeyValueSignatures[i].Confidence)
+	}
+	for i := range s.CompositeSignatures {
+		apply(s.CompositeSignatures[i].ID, &s.CompositeSignatures[i].Severity, &s.CompositeSignatures[i].Confidence)
+	}
+	matcherIDs := matcherSignatureIDs()
+	var unused []string
+	for id, override := range overrides {
+		switch {
+		case applied[id]:
+		case matcherIDs[id]:
+			if s.matcherOverrides == nil {
+				s.matcherOverrides = make(map[string]SeverityOverride)
+			}
+			s.matcherOverrides[id] = SeverityOverride{strings.ToLower(override.Severity), strings.ToLower(override.Confidence)}
+		default:
+			unused = append(unused, id)
+		}
+	}
+	sort.Strings(unused)
+	return unused, nil
+}
+
+// OverrideFinding applies the override of a built-in matcher signature, such
+// as jwt or pii-iban, to a finding it produced.
+func (s *Signatures) OverrideFinding(f *Finding) {
+	override, ok := s.matcherOverrides[f.ContentSignatureID]
+	if !ok {
+		return
+	}
+	if override.Severity != "" {
+		f.Severity = override.Severity
+	}
+	if override.Confidence != "" {
+		f.Confidence = override.Confidence
+	}
+}
+
+// FindingRating picks the severity and confidence of a finding from the
+// signatures that produced it. The more severe signature wins; on a tie the
+// content signature, which looked at the actual data, decides the confidence.
+func FindingRating(fileSignature, contentSignature Signature) (string, string) {
+	if SeverityRank(fileSignature.GetSeverity()) > SeverityRank(contentSignature.GetSeverity()) {
+		return fileSignature.GetSeverity(), fileSignature.GetConfidence()
+	}
+	return contentSignature.GetSeverity(), contentSignature.GetConfidence()
+}
+
+// SortFindings orders findings by descending severity, then by descending
+// confidence. Findings of equal rank keep their relative order.
+func SortFindings(findings []*Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if SeverityRank(a.Severity) != SeverityRank(b.Severity) {
+			return SeverityRank(a.Severity) > SeverityRank(b.Severity)
+		}
+		return ConfidenceRank(a.Confidence) > ConfidenceRank(b.Confidence)
+	})
+}
+
+// MeetsThreshold reports whether the finding is at least as severe and as
+// confident as the given levels. Empty levels don't filter.
+func (f *Finding) MeetsThreshold(minSeverity, minConfidence string) bool {
+	if minSeverity != "" && SeverityRank(f.Severity) < SeverityRank(minSeverity) {
+		return false
+	}
+	if minConfidence != "" && ConfidenceRank(f.Confidence) < ConfidenceRank(minConfidence) {
+		return false
+	}
+	return true
+}
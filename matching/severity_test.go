@@ -0,0 +1,181 @@
+package matching
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	tests := []struct {
+		name       string
+		overrides  map[string]SeverityOverride
+		wantUnused []string
+		wantErr    string
+		check      func(t *testing.T, s *Signatures)
+	}{
+		{
+			name: "loaded signatures",
+			overrides: map[string]SeverityOverride{
+				"env-file":   {Severity: "LOW"},
+				"aws-secret": {Confidence: "low"},
+			},
+			check: func(t *testing.T, s *Signatures) {
+				if got := s.FileSignatures[0]; got.Severity != SeverityLow || got.Confidence != ConfidenceHigh {
+					t.Errorf("env-file is %s/%s, want low/high", got.Severity, got.Confidence)
+				}
+				if got := s.ContentSignatures[0]; got.Severity != SeverityCritical || got.Confidence != ConfidenceLow {
+					t.Errorf("aws-secret is %s/%s, want critical/low", got.Severity, got.Confidence)
+				}
+			},
+		},
+		{
+			name:      "built-in matcher signatures",
+			overrides: map[string]SeverityOverride{"jwt": {Severity: "Info"}, "pii-iban": {Confidence: "low"}},
+			check: func(t *testing.T, s *Signatures) {
+				jwt := &Finding{ContentSignatureID: "jwt", Severity: SeverityHigh, Confidence: ConfidenceHigh}
+				s.OverrideFinding(jwt)
+				if jwt.Severity != SeverityInfo || jwt.Confidence != ConfidenceHigh {
+					t.Errorf("jwt finding is %s/%s, want info/high", jwt.Severity, jwt.Confidence)
+				}
+				iban := &Finding{ContentSignatureID: "pii-iban", Severity: SeverityMedium, Confidence: ConfidenceHigh}
+				s.OverrideFinding(iban)
+				if iban.Severity != SeverityMedium || iban.Confidence != ConfidenceLow {
+					t.Errorf("pii-iban finding is %s/%s, want medium/low", iban.Severity, iban.Confidence)
+				}
+				other := &Finding{ContentSignatureID: "aws-secret", Severity: SeverityCritical}
+				s.OverrideFinding(other)
+				if other.Severity != SeverityCritical {
+					t.Errorf("aws-secret finding is %s, want critical", other.Severity)
+				}
+			},
+		},
+		{
+			name:       "unknown signatures",
+			overrides:  map[string]SeverityOverride{"typo": {Severity: "low"}, "another-typo": {Severity: "low"}, "env-file": {}},
+			wantUnused: []string{"another-typo", "typo"},
+		},
+		{
+			name:      "invalid severity",
+			overrides: map[string]SeverityOverride{"env-file": {Severity: "severe"}},
+			wantErr:   "env-file: invalid severity",
+		},
+		{
+			name:      "invalid confidence",
+			overrides: map[string]SeverityOverride{"jwt": {Confidence: "certain"}},
+			wantErr:   "jwt: invalid confidence",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Signatures{
+				FileSignatures:    []FileSignature{{ID: "env-file", Severity: SeverityHigh, Confidence: ConfidenceHigh}},
+				ContentSignatures: []ContentSignature{{ID: "aws-secret", Severity: SeverityCritical, Confidence: ConfidenceHigh}},
+			}
+			unused, err := s.ApplyOverrides(test.overrides)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(unused, test.wantUnused) {
+				t.Errorf("unused = %v, want %v", unused, test.wantUnused)
+			}
+			if test.check != nil {
+				test.check(t, s)
+			}
+		})
+	}
+}
+
+func TestFindingRating(t *testing.T) {
+	tests := []struct {
+		name                         string
+		file, content                Signature
+		wantSeverity, wantConfidence string
+	}{
+		{
+			name:           "more severe file signature",
+			file:           FileSignature{Severity: SeverityHigh, Confidence: ConfidenceLow},
+			content:        ContentSignature{Severity: SeverityMedium, Confidence: ConfidenceHigh},
+			wantSeverity:   SeverityHigh,
+			wantConfidence: ConfidenceLow,
+		},
+		{
+			name:           "more severe content signature",
+			file:           FileSignature{Severity: SeverityLow, Confidence: ConfidenceHigh},
+			content:        ContentSignature{Severity: SeverityCritical, Confidence: ConfidenceMedium},
+			wantSeverity:   SeverityCritical,
+			wantConfidence: ConfidenceMedium,
+		},
+		{
+			name:           "tie",
+			file:           FileSignature{Severity: SeverityHigh, Confidence: ConfidenceLow},
+			content:        ContentSignature{Severity: SeverityHigh, Confidence: ConfidenceHigh},
+			wantSeverity:   SeverityHigh,
+			wantConfidence: ConfidenceHigh,
+		},
+		{
+			name:           "file match only",
+			file:           FileSignature{Severity: SeverityMedium, Confidence: ConfidenceMedium},
+			content:        ContentSignature{Description: "NA"},
+			wantSeverity:   SeverityMedium,
+			wantConfidence: ConfidenceMedium,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			severity, confidence := FindingRating(test.file, test.content)
+			if severity != test.wantSeverity || confidence != test.wantConfidence {
+				t.Errorf("FindingRating = %s/%s, want %s/%s", severity, confidence, test.wantSeverity, test.wantConfidence)
+			}
+		})
+	}
+}
+
+func TestSortFindings(t *testing.T) {
+	findings := []*Finding{
+		{ID: "low", Severity: SeverityLow, Confidence: ConfidenceHigh},
+		{ID: "high-low", Severity: SeverityHigh, Confidence: ConfidenceLow},
+		{ID: "unrated"},
+		{ID: "critical", Severity: SeverityCritical, Confidence: ConfidenceMedium},
+		{ID: "high-high", Severity: SeverityHigh, Confidence: ConfidenceHigh},
+		{ID: "high-low-2", Severity: "HIGH", Confidence: "low"},
+	}
+	SortFindings(findings)
+	var ids []string
+	for _, finding := range findings {
+		ids = append(ids, finding.ID)
+	}
+	want := []string{"critical", "high-high", "high-low", "high-low-2", "low", "unrated"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("order = %v, want %v", ids, want)
+	}
+}
+
+func TestMeetsThreshold(t *testing.T) {
+	finding := &Finding{Severity: SeverityHigh, Confidence: ConfidenceMedium}
+	tests := []struct {
+		minSeverity, minConfidence string
+		want                       bool
+	}{
+		{"", "", true},
+		{SeverityHigh, "", true},
+		{SeverityMedium, ConfidenceMedium, true},
+		{"CRITICAL", "", false},
+		{"", ConfidenceHigh, false},
+		{SeverityInfo, ConfidenceLow, true},
+	}
+	for _, test := range tests {
+		if got := finding.MeetsThreshold(test.minSeverity, test.minConfidence); got != test.want {
+			t.Errorf("MeetsThreshold(%q, %q) = %v, want %v", test.minSeverity, test.minConfidence, got, test.want)
+		}
+	}
+	if (&Finding{}).MeetsThreshold(SeverityInfo, "") {
+		t.Error("a finding without severity meets -min-severity info, want it filtered")
+	}
+}
@@ -0,0 +1,9 @@
+package matching
+
+type Signature interface {
+	GetID() string
+	GetDescription() string
+	GetComment() string
+	GetSeverity() string
+	GetConfidence() string
+}
@@ -3,42 +3,365 @@ package matching
 import (
 	"encoding/json"
 	"fmt"
-	"gitrob/common"
+	"io/fs"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
 type Signatures struct {
-	FileSignatures    []FileSignature
-	ContentSignatures []ContentSignature
+	FileSignatures      []FileSignature
+	ContentSignatures   []ContentSignature
+	KeyValueSignatures  []KeyValueSignature
+	CompositeSignatures []CompositeSignature
+	ContentExclusions   []string
+	prefilter           *Prefilter
+	// defaultExclusions are the content exclusions of the built-in
+	// signatures that no signature file lists again.
+	defaultExclusions map[string]bool
+	// matcherOverrides are the severity overrides of built-in matcher
+	// signatures, which are applied to findings.
+	matcherOverrides map[string]SeverityOverride
 }
 
-func (s *Signatures) loadSignatures(path string) error {
-	if !common.FileExists(path) {
+// DefaultSignatures holds the built-in signature files. It reads them from the
+// working directory unless the binary embeds them.
+var DefaultSignatures fs.FS = os.DirFS(".")
+
+var defaultSignatureFiles = []string{
+	"filesignatures.json",
+	//source:  https://github.com/dxa4481/truffleHogRegexes/blob/master/truffleHogRegexes/regexes.json
+	"contentsignatures.json",
+	"keyvaluesignatures.json",
+	"compositesignatures.json",
+}
+
+func parseSignatures(name string, data []byte) (*Signatures, error) {
+	var signatures Signatures
+	if err := json.Unmarshal(data, &signatures); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	ids := make(map[string]bool)
+	for _, id := range signatures.ids() {
+		if id != "" && ids[id] {
+			return nil, fmt.Errorf("%s: duplicate signature ID: %s", name, id)
+		}
+		ids[id] = true
+	}
+	return &signatures, nil
+}
+
+func (s *Signatures) ids() []string {
+	var ids []string
+	for _, sig := range s.FileSignatures {
+		ids = append(ids, sig.ID)
+	}
+	for _, sig := range s.ContentSignatures {
+		ids = append(ids, sig.ID)
+	}
+	for _, sig := range s.KeyValueSignatures {
+		ids = append(ids, sig.ID)
+	}
+	for _, sig := range s.CompositeSignatures {
+		ids = append(ids, sig.ID)
+	}
+	return ids
+}
+
+// merge adds the signatures of other. A signature with the ID of one of the
+// same type that is already loaded replaces it, so a signature pack can
+// redefine built-in signatures.
+func (s *Signatures) merge(other *Signatures) {
+	for _, sig := range other.FileSignatures {
+		replaced := false
+		for i := range s.FileSignatures {
+			if sig.ID != "" && s.FileSignatures[i].ID == sig.ID {
+				s.FileSignatures[i], replaced = sig, true
+			}
+		}
+		if !replaced {
+			s.FileSignatures = append(s.FileSignatures, sig)
+		}
+	}
+	for _, sig := range other.ContentSignatures {
+		replaced := false
+		for i := range s.ContentSignatures {
+			if sig.ID != "" && s.ContentSignatures[i].ID == sig.ID {
+				s.ContentSignatures[i], replaced = sig, true
+			}
+		}
+		if !replaced {
+			s.ContentSignatures = append(s.ContentSignatures, sig)
+		}
+	}
+	for _, sig := range other.KeyValueSignatures {
+		replaced := false
+		for i := range s.KeyValueSignatures {
+			if sig.ID != "" && s.KeyValueSignatures[i].ID == sig.ID {
+				s.KeyValueSignatures[i], replaced = sig, true
+			}
+		}
+		if !replaced {
+			s.KeyValueSignatures = append(s.KeyValueSignatures, sig)
+		}
+	}
+	for _, glob := range other.ContentExclusions {
+		s.AddContentExclusion(glob)
+	}
+	for _, sig := range other.CompositeSignatures {
+		replaced := false
+		for i := range s.CompositeSignatures {
+			if sig.ID != "" && s.CompositeSignatures[i].ID == sig.ID {
+				s.CompositeSignatures[i], replaced = sig, true
+			}
+		}
+		if !replaced {
+			s.CompositeSignatures = append(s.CompositeSignatures, sig)
+		}
+	}
+}
+
+// AddContentExclusion adds a glob of files that content and key/value
+// signatures skip.
+func (s *Signatures) AddContentExclusion(glob string) {
+	for _, existing := range s.ContentExclusions {
+		if existing == glob {
+			return
+		}
+	}
+	s.ContentExclusions = append(s.ContentExclusions, glob)
+}
+
+// RemoveDefaultContentExclusions removes the content exclusions of the
+// built-in signatures, keeping those of signature files and packs.
+func (s *Signatures) RemoveDefaultContentExclusions() {
+	exclusions := s.ContentExclusions[:0]
+	for _, glob := range s.ContentExclusions {
+		if !s.defaultExclusions[glob] {
+			exclusions = append(exclusions, glob)
+		}
+	}
+	s.ContentExclusions = exclusions
+}
+
+func (s *Signatures) loadDefaults() error {
+	for _, name := range defaultSignatureFiles {
+		data, err := fs.ReadFile(DefaultSignatures, name)
+		if err != nil {
+			return fmt.Errorf("missing signature file: %s", name)
+		}
+		signatures, err := parseSignatures(name, data)
+		if err != nil {
+			return err
+		}
+		s.merge(signatures)
+	}
+	s.defaultExclusions = make(map[string]bool)
+	for _, glob := range s.ContentExclusions {
+		s.defaultExclusions[glob] = true
+	}
+	return nil
+}
+
+// loadPath loads a signature file, or every .json file in a directory in
+// lexical order. A directory is a signature pack.
+func (s *Signatures) loadPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
 		return fmt.Errorf("missing signature file: %s", path)
 	}
-	data, readError := ioutil.ReadFile(path)
-	if readError != nil {
-		return readError
+	paths := []string{path}
+	if info.IsDir() {
+		if paths, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+			return err
+		}
+		sort.Strings(paths)
 	}
-	if unmarshalError := json.Unmarshal(data, &s); unmarshalError != nil {
-		return unmarshalError
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		signatures, err := parseSignatures(p, data)
+		if err != nil {
+			return err
+		}
+		for _, glob := range signatures.ContentExclusions {
+			delete(s.defaultExclusions, glob)
+		}
+		s.merge(signatures)
+	}
+	return nil
+}
+
+// Disable removes the signatures with the given IDs.
+func (s *Signatures) Disable(ids []string) error {
+	known := make(map[string]bool)
+	for _, id := range s.ids() {
+		known[id] = true
+	}
+	disabled := make(map[string]bool)
+	for _, id := range ids {
+		if !known[id] {
+			return fmt.Errorf("unknown signature ID: %s", id)
+		}
+		disabled[id] = true
+	}
+	fileSignatures := s.FileSignatures[:0]
+	for _, sig := range s.FileSignatures {
+		if !disabled[sig.ID] {
+			fileSignatures = append(fileSignatures, sig)
+		}
+	}
+	s.FileSignatures = fileSignatures
+	contentSignatures := s.ContentSignatures[:0]
+	for _, sig := range s.ContentSignatures {
+		if !disabled[sig.ID] {
+			contentSignatures = append(contentSignatures, sig)
+		}
+	}
+	s.ContentSignatures = contentSignatures
+	keyValueSignatures := s.KeyValueSignatures[:0]
+	for _, sig := range s.KeyValueSignatures {
+		if !disabled[sig.ID] {
+			keyValueSignatures = append(keyValueSignatures, sig)
+		}
+	}
+	s.KeyValueSignatures = keyValueSignatures
+	compositeSignatures := s.CompositeSignatures[:0]
+	for _, sig := range s.CompositeSignatures {
+		if !disabled[sig.ID] {
+			compositeSignatures = append(compositeSignatures, sig)
+		}
+	}
+	s.CompositeSignatures = compositeSignatures
+	return nil
+}
+
+// Load reads the built-in signatures and then the signature files and packs
+// in paths, drops the disabled signatures and keeps the ones that are used in
+// the given mode. Composite signatures are used in every mode but mode 4,
+// except for those with content conditions in mode 1.
+func (s *Signatures) Load(mode int, paths, disabled []string) error {
+	if mode < ModeFileMatch || mode > ModePII {
+		return fmt.Errorf("unknown mode %d", mode)
+	}
+	if err := s.loadDefaults(); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := s.loadPath(path); err != nil {
+			return err
+		}
+	}
+	if err := s.Disable(disabled); err != nil {
+		return err
 	}
+	if mode == ModeFileMatch {
+		s.ContentSignatures = nil
+		s.KeyValueSignatures = nil
+		s.ContentExclusions = nil
+		compositeSignatures := s.CompositeSignatures[:0]
+		for _, sig := range s.CompositeSignatures {
+			if !sig.Condition.UsesContent() {
+				compositeSignatures = append(compositeSignatures, sig)
+			}
+		}
+		s.CompositeSignatures = compositeSignatures
+	}
+	if mode == ModeContentMatch {
+		s.FileSignatures = nil
+	}
+	if mode == ModePII {
+		s.FileSignatures = nil
+		s.ContentSignatures = nil
+		s.KeyValueSignatures = nil
+		s.CompositeSignatures = nil
+	}
+	if err := s.validate(); err != nil {
+		return err
+	}
+	s.prefilter = NewPrefilter(s.ContentSignatures)
 	return nil
 }
 
-func (s *Signatures) Load(mode int) error {
-	var e error
-	if mode != ModeContentMatch {
-		e = s.loadSignatures("./filesignatures.json")
-		if e != nil {
-			return e
+// ContentCandidates reports for each content signature whether it should run
+// on the content according to its keywords. Without a prefilter, which is
+// built by Load, every signature is a candidate.
+func (s *Signatures) ContentCandidates(content string) []bool {
+	if s.prefilter == nil {
+		candidates := make([]bool, len(s.ContentSignatures))
+		for i := range candidates {
+			candidates[i] = true
 		}
+		return candidates
 	}
-	if mode != ModeFileMatch {
-		//source:  https://github.com/dxa4481/truffleHogRegexes/blob/master/truffleHogRegexes/regexes.json
-		e = s.loadSignatures("./contentsignatures.json")
-		if e != nil {
-			return e
+	return s.prefilter.Candidates(content)
+}
+
+// validate makes sure every signature has a unique ID and a known severity and
+// confidence. Signatures that don't declare a severity or confidence get medium.
+func (s *Signatures) validate() error {
+	ids := make(map[string]bool)
+	check := func(id, description string, severity, confidence *string) error {
+		if id == "" {
+			return fmt.Errorf("signature '%s' has no ID", description)
+		}
+		if ids[id] {
+			return fmt.Errorf("duplicate signature ID: %s", id)
+		}
+		ids[id] = true
+		if *severity == "" {
+			*severity = SeverityMedium
+		}
+		if *confidence == "" {
+			*confidence = ConfidenceMedium
+		}
+		if err := ValidateSeverity(*severity); err != nil {
+			return fmt.Errorf("%s: %s", id, err)
+		}
+		if err := ValidateConfidence(*confidence); err != nil {
+			return fmt.Errorf("%s: %s", id, err)
+		}
+		*severity = strings.ToLower(*severity)
+		*confidence = strings.ToLower(*confidence)
+		return nil
+	}
+	for i := range s.FileSignatures {
+		sig := &s.FileSignatures[i]
+		if err := check(sig.ID, sig.Description, &sig.Severity, &sig.Confidence); err != nil {
+			return err
+		}
+	}
+	for i := range s.ContentSignatures {
+		sig := &s.ContentSignatures[i]
+		if err := check(sig.ID, sig.Description, &sig.Severity, &sig.Confidence); err != nil {
+			return err
+		}
+		if err := validateFileTypes(sig.FileTypes); err != nil {
+			return fmt.Errorf("%s: %s", sig.ID, err)
+		}
+		for _, keyword := range sig.Keywords {
+			if keyword == "" {
+				return fmt.Errorf("%s: empty keyword", sig.ID)
+			}
+		}
+	}
+	for i := range s.KeyValueSignatures {
+		sig := &s.KeyValueSignatures[i]
+		if err := check(sig.ID, sig.Description, &sig.Severity, &sig.Confidence); err != nil {
+			return err
+		}
+	}
+	for i := range s.CompositeSignatures {
+		sig := &s.CompositeSignatures[i]
+		if err := check(sig.ID, sig.Description, &sig.Severity, &sig.Confidence); err != nil {
+			return err
+		}
+		if err := sig.Condition.Validate(); err != nil {
+			return fmt.Errorf("%s: %s", sig.ID, err)
 		}
 	}
 	return nil
@@ -0,0 +1,170 @@
+package matching
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRemoveDefaultContentExclusions(t *testing.T) {
+	DefaultSignatures = os.DirFS("..")
+	defer func() { DefaultSignatures = os.DirFS(".") }()
+	var defaults Signatures
+	if err := defaults.loadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if len(defaults.ContentExclusions) == 0 {
+		t.Fatal("the built-in signatures have no content exclusions")
+	}
+	builtIn := defaults.ContentExclusions[0]
+
+	pack := filepath.Join(t.TempDir(), "pack.json")
+	data := []byte(`{"ContentExclusions": ["**/generated/**", "` + builtIn + `"]}`)
+	if err := ioutil.WriteFile(pack, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	var signatures Signatures
+	if err := signatures.Load(ModeContentMatch, []string{pack}, nil); err != nil {
+		t.Fatal(err)
+	}
+	signatures.AddContentExclusion("**/dist/**")
+	signatures.RemoveDefaultContentExclusions()
+	want := []string{builtIn, "**/generated/**", "**/dist/**"}
+	if !reflect.DeepEqual(signatures.ContentExclusions, want) {
+		t.Errorf("ContentExclusions = %q, want %q", signatures.ContentExclusions, want)
+	}
+}
+
+func testBaseSignatures() *Signatures {
+	return &Signatures{
+		FileSignatures:    []FileSignature{{ID: "env-file", Part: "filename", MatchOn: `^\.env$`}},
+		ContentSignatures: []ContentSignature{{ID: "aws-secret", MatchOn: "AKIA", Severity: SeverityCritical}},
+	}
+}
+
+func TestLoadPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		path    string
+		wantIDs []string
+		wantErr string
+		check   func(t *testing.T, s *Signatures)
+	}{
+		{
+			name:    "signature file",
+			files:   map[string]string{"custom.json": `{"ContentSignatures": [{"ID": "acme-token", "MatchOn": "acme_[0-9a-f]{32}"}]}`},
+			path:    "custom.json",
+			wantIDs: []string{"env-file", "aws-secret", "acme-token"},
+		},
+		{
+			name: "signature pack",
+			files: map[string]string{
+				"pack/b.json":    `{"ContentSignatures": [{"ID": "acme-token", "MatchOn": "acme", "Severity": "high"}]}`,
+				"pack/a.json":    `{"ContentSignatures": [{"ID": "acme-token", "MatchOn": "acme", "Severity": "low"}], "FileSignatures": [{"ID": "acme-key", "Part": "extension", "MatchOn": "^\\.acme$"}]}`,
+				"pack/notes.txt": `not a signature file`,
+			},
+			path:    "pack",
+			wantIDs: []string{"env-file", "acme-key", "aws-secret", "acme-token"},
+			check: func(t *testing.T, s *Signatures) {
+				if severity := s.ContentSignatures[1].Severity; severity != SeverityHigh {
+					t.Errorf("acme-token severity = %s, want %s from the later file of the pack", severity, SeverityHigh)
+				}
+			},
+		},
+		{
+			name:    "signature replaced by ID",
+			files:   map[string]string{"override.json": `{"ContentSignatures": [{"ID": "aws-secret", "MatchOn": "ASIA", "Severity": "high"}]}`},
+			path:    "override.json",
+			wantIDs: []string{"env-file", "aws-secret"},
+			check: func(t *testing.T, s *Signatures) {
+				if sig := s.ContentSignatures[0]; sig.MatchOn != "ASIA" || sig.Severity != SeverityHigh {
+					t.Errorf("aws-secret = %+v, want the signature of the file", sig)
+				}
+			},
+		},
+		{
+			name:    "duplicate IDs in a file",
+			files:   map[string]string{"duplicate.json": `{"ContentSignatures": [{"ID": "acme-token"}, {"ID": "acme-token"}]}`},
+			path:    "duplicate.json",
+			wantErr: "duplicate signature ID: acme-token",
+		},
+		{
+			name:    "invalid JSON",
+			files:   map[string]string{"invalid.json": `{"ContentSignatures": [`},
+			path:    "invalid.json",
+			wantErr: "invalid.json",
+		},
+		{
+			name:    "missing file",
+			path:    "missing.json",
+			wantErr: "missing signature file",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.files {
+				location := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(location), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(location, []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := testBaseSignatures()
+			err := s.loadPath(filepath.Join(dir, test.path))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := s.ids(); !reflect.DeepEqual(ids, test.wantIDs) {
+				t.Errorf("IDs = %v, want %v", ids, test.wantIDs)
+			}
+			if test.check != nil {
+				test.check(t, s)
+			}
+		})
+	}
+}
+
+func TestDisable(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []string
+		wantIDs []string
+		wantErr string
+	}{
+		{name: "nothing", wantIDs: []string{"env-file", "aws-secret"}},
+		{name: "content signature", ids: []string{"aws-secret"}, wantIDs: []string{"env-file"}},
+		{name: "every signature", ids: []string{"aws-secret", "env-file"}},
+		{name: "unknown ID", ids: []string{"aws-secrets"}, wantErr: "unknown signature ID: aws-secrets"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := testBaseSignatures()
+			err := s.Disable(test.ids)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := s.ids(); !reflect.DeepEqual(ids, test.wantIDs) {
+				t.Errorf("IDs = %v, want %v", ids, test.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package matching
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// maxProgramSize is the number of instructions above which a compiled pattern
+// is reported, which mostly catches large counted repetitions like (a{1,100}){1,100}.
+const maxProgramSize = 20000
+
+type SignatureTestResult struct {
+	ID       string
+	Examples int
+	Failures []string
+}
+
+// Test runs the examples and counterexamples of every signature through its
+// Match method, checks that examples of content signatures contain one of their
+// keywords and checks the patterns for constructs that backtrack
+// catastrophically in backtracking regular expression engines. Go's engine is
+// immune, but signatures are commonly shared with tools that aren't.
+func (s *Signatures) Test() []SignatureTestResult {
+	var results []SignatureTestResult
+	for _, sig := range s.FileSignatures {
+		result := SignatureTestResult{ID: sig.ID}
+		result.checkPattern("MatchOn", sig.MatchOn)
+		for _, example := range sig.Examples {
+			result.checkExample(example, true, func() (bool, error) { return sig.Match(NewMatchTarget(example)) })
+		}
+		for _, example := range sig.Counterexamples {
+			result.checkExample(example, false, func() (bool, error) { return sig.Match(NewMatchTarget(example)) })
+		}
+		results = append(results, result)
+	}
+	for _, sig := range s.ContentSignatures {
+		result := SignatureTestResult{ID: sig.ID}
+		result.checkPattern("MatchOn", sig.MatchOn)
+		for _, example := range sig.Examples {
+			if !sig.hasKeyword(example) {
+				result.Failures = append(result.Failures, fmt.Sprintf("example %q contains none of the keywords", example))
+			}
+			result.checkExample(example, true, func() (bool, error) { return sig.Match(MatchTarget{Content: example}) })
+		}
+		for _, example := range sig.Counterexamples {
+			result.checkExample(example, false, func() (bool, error) { return sig.Match(MatchTarget{Content: example}) })
+		}
+		results = append(results, result)
+	}
+	for _, sig := range s.KeyValueSignatures {
+		result := SignatureTestResult{ID: sig.ID}
+		result.checkPattern("KeyMatchOn", sig.KeyMatchOn)
+		result.checkPattern("ValueMatchOn", sig.ValueMatchOn)
+		for _, example := range sig.Examples {
+			result.checkExample(example, true, func() (bool, error) { return sig.Match(parseKeyValueExample(example)) })
+		}
+		for _, example := range sig.Counterexamples {
+			result.checkExample(example, false, func() (bool, error) { return sig.Match(parseKeyValueExample(example)) })
+		}
+		results = append(results, result)
+	}
+	for _, sig := range s.CompositeSignatures {
+		result := SignatureTestResult{ID: sig.ID}
+		result.checkCondition(sig.Condition)
+		for _, example := range sig.Examples {
+			example := example
+			result.checkExample(example.Path, true, func() (bool, error) {
+				return sig.Match(NewMatchTarget(example.Path), func() (string, error) { return example.Content, nil })
+			})
+		}
+		for _, example := range sig.Counterexamples {
+			example := example
+			result.checkExample(example.Path, false, func() (bool, error) {
+				return sig.Match(NewMatchTarget(example.Path), func() (string, error) { return example.Content, nil })
+			})
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// parseKeyValueExample splits a key/value signature example written as key=value.
+func parseKeyValueExample(example string) KeyValuePair {
+	parts := strings.SplitN(example, "=", 2)
+	if len(parts) == 1 {
+		return KeyValuePair{Key: parts[0]}
+	}
+	return KeyValuePair{Key: parts[0], Value: parts[1]}
+}
+
+func (r *SignatureTestResult) checkExample(example string, shouldMatch bool, match func() (bool, error)) {
+	r.Examples++
+	matched, err := match()
+	switch {
+	case err != nil:
+		r.Failures = append(r.Failures, fmt.Sprintf("error matching %q: %s", example, err))
+	case shouldMatch && !matched:
+		r.Failures = append(r.Failures, fmt.Sprintf("example %q does not match", example))
+	case !shouldMatch && matched:
+		r.Failures = append(r.Failures, fmt.Sprintf("counterexample %q matches", example))
+	}
+}
+
+func (r *SignatureTestResult) checkPattern(field, pattern string) {
+	if pattern == "" {
+		return
+	}
+	for _, problem := range CheckPattern(pattern) {
+		r.Failures = append(r.Failures, fmt.Sprintf("%s: %s", field, problem))
+	}
+}
+
+func (r *SignatureTestResult) checkCondition(c Condition) {
+	r.checkPattern("Path", c.Path)
+	r.checkPattern("Filename", c.Filename)
+	r.checkPattern("Extension", c.Extension)
+	r.checkPattern("Content", c.Content)
+	if c.Near != nil {
+		for _, pattern := range c.Near.Patterns {
+			r.checkPattern("Near", pattern)
+		}
+	}
+	for _, sub := range append(append([]Condition{}, c.All...), c.Any...) {
+		r.checkCondition(sub)
+	}
+	if c.Not != nil {
+		r.checkCondition(*c.Not)
+	}
+}
+
+// CheckPattern reports syntax errors, nested unbounded quantifiers such as
+// (a+)+, adjacent unbounded quantifiers over overlapping characters such as
+// \w*\d+, and patterns that compile to very large programs.
+func CheckPattern(pattern string) []string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	walkPattern(re, nil, &problems)
+	if prog, err := syntax.Compile(re.Simplify()); err == nil && len(prog.Inst) > maxProgramSize {
+		problems = append(problems, fmt.Sprintf("pattern compiles to %d instructions", len(prog.Inst)))
+	}
+	return problems
+}
+
+func walkPattern(re *syntax.Regexp, enclosing *syntax.Regexp, problems *[]string) {
+	if isUnbounded(re) {
+		if enclosing != nil {
+			*problems = append(*problems, fmt.Sprintf("nested quantifier %s inside %s", re, enclosing))
+			return
+		}
+		enclosing = re
+	}
+	if re.Op == syntax.OpConcat {
+		for i := 0; i+1 < len(re.Sub); i++ {
+			a, b := re.Sub[i], re.Sub[i+1]
+			if isUnbounded(a) && isUnbounded(b) && overlaps(a.Sub[0], b.Sub[0]) {
+				*problems = append(*problems, fmt.Sprintf("adjacent quantifiers %s%s overlap", a, b))
+			}
+		}
+	}
+	for _, sub := range re.Sub {
+		walkPattern(sub, enclosing, problems)
+	}
+}
+
+func isUnbounded(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		return true
+	case syntax.OpRepeat:
+		return re.Max == -1
+	default:
+		return false
+	}
+}
+
+// overlaps reports whether two single character expressions can match the same
+// character. Anything more complex is assumed not to overlap.
+func overlaps(a, b *syntax.Regexp) bool {
+	ra, rb := runeRanges(a), runeRanges(b)
+	for i := 0; i+1 < len(ra); i += 2 {
+		for j := 0; j+1 < len(rb); j += 2 {
+			if ra[i] <= rb[j+1] && rb[j] <= ra[i+1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func runeRanges(re *syntax.Regexp) []rune {
+	switch re.Op {
+	case syntax.OpCharClass:
+		return re.Rune
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return []rune{0, unicode.MaxRune}
+	case syntax.OpLiteral:
+		if len(re.Rune) == 1 {
+			return []rune{re.Rune[0], re.Rune[0]}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package matching
+
+import (
+	"regexp"
+	"strings"
+)
+
+// suppressionPattern matches gitrob:allow[id,id], gitrob:allow id,id and a
+// bare gitrob:allow, in that order, so that a word that could be a signature ID
+// after the annotation never suppresses every signature.
+var suppressionPattern = regexp.MustCompile(
+	`gitrob:allow(?:\[([^\]\n]*)\]|[ \t]+([A-Za-z0-9][\w.\-]*(?:[ \t]*,[ \t]*[A-Za-z0-9][\w.\-]*)*)|\b)`)
+
+// Suppression records the inline annotation that suppressed a finding.
+type Suppression struct {
+	Line       int
+	Annotation string
+}
+
+// FindSuppression looks for a gitrob:allow annotation on the line holding
+// offset in content, or on the line above it. A bare gitrob:allow suppresses
+// every signature, gitrob:allow[id,id] and gitrob:allow id,id only those
+// signatures. Text after the annotation, such as the reason for it, is recorded
+// with it.
+func FindSuppression(content string, offset int, signatureID string) *Suppression {
+	if offset < 0 || offset > len(content) {
+		return nil
+	}
+	start := strings.LastIndex(content[:offset], "\n") + 1
+	line := LineNumber(content, start)
+	end := strings.Index(content[offset:], "\n")
+	if end == -1 {
+		end = len(content)
+	} else {
+		end += offset
+	}
+	if annotation, ok := matchSuppression(content[start:end], signatureID); ok {
+		return &Suppression{Line: line, Annotation: annotation}
+	}
+	if start == 0 {
+		return nil
+	}
+	previous := strings.LastIndex(content[:start-1], "\n") + 1
+	if annotation, ok := matchSuppression(content[previous:start-1], signatureID); ok {
+		return &Suppression{Line: line - 1, Annotation: annotation}
+	}
+	return nil
+}
+
+// LineNumber returns the line, counting from 1, that holds offset in content.
+func LineNumber(content string, offset int) int {
+	return strings.Count(content[:offset], "\n") + 1
+}
+
+func matchSuppression(line, signatureID string) (string, bool) {
+	for _, loc := range suppressionPattern.FindAllStringSubmatchIndex(line, -1) {
+		annotation := strings.TrimSpace(line[loc[0]:])
+		var ids string
+		switch {
+		case loc[2] != -1:
+			ids = line[loc[2]:loc[3]]
+		case loc[4] != -1:
+			ids = line[loc[4]:loc[5]]
+		default:
+			return annotation, true
+		}
+		for _, id := range strings.Split(ids, ",") {
+			if strings.TrimSpace(id) == signatureID {
+				return annotation, true
+			}
+		}
+	}
+	return "", false
+}
+
+// FirstUnsuppressed returns the first location that isn't suppressed. When
+// every location is suppressed it returns the suppression of the first one.
+func FirstUnsuppressed(content string, locs [][]int, signatureID string) ([]int, *Suppression) {
+	var first *Suppression
+	for _, loc := range locs {
+		suppression := FindSuppression(content, loc[0], signatureID)
+		if suppression == nil {
+			return loc, nil
+		}
+		if first == nil {
+			first = suppression
+		}
+	}
+	return nil, first
+}
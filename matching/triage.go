@@ -0,0 +1,55 @@
+package matching
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	TriageUntriaged     = "untriaged"
+	TriageFalsePositive = "false-positive"
+	TriageConfirmed     = "confirmed"
+	TriageRevoked       = "revoked"
+	TriageAcceptedRisk  = "accepted-risk"
+)
+
+var TriageStatuses = []string{TriageUntriaged, TriageFalsePositive, TriageConfirmed, TriageRevoked, TriageAcceptedRisk}
+
+// Triage is the outcome of reviewing a finding. It is stored by the
+// fingerprint of the finding, so it applies to every finding with the same
+// fingerprint in this and later scans.
+type Triage struct {
+	Status    string
+	Assignee  string
+	Notes     string
+	UpdatedAt time.Time
+}
+
+// MergeTriage adds the triage of other to triage, keeping the more recent
+// triage of a fingerprint.
+func MergeTriage(triage, other map[string]*Triage) {
+	for fingerprint, t := range other {
+		if current, ok := triage[fingerprint]; !ok || current.UpdatedAt.Before(t.UpdatedAt) {
+			triage[fingerprint] = t
+		}
+	}
+}
+
+func ValidateTriageStatus(status string) error {
+	for _, s := range TriageStatuses {
+		if status == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown triage status %q, expected one of %s", status, strings.Join(TriageStatuses, ", "))
+}
+
+// TriageStatus returns the status of the finding, which is untriaged when it
+// has no triage.
+func (f *Finding) TriageStatus() string {
+	if f.Triage == nil || f.Triage.Status == "" {
+		return TriageUntriaged
+	}
+	return f.Triage.Status
+}
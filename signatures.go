@@ -0,0 +1,14 @@
+package main
+
+import (
+	"embed"
+
+	"gitrob/matching"
+)
+
+//go:embed filesignatures.json contentsignatures.json keyvaluesignatures.json compositesignatures.json
+var defaultSignatures embed.FS
+
+func init() {
+	matching.DefaultSignatures = defaultSignatures
+}
@@ -34,8 +34,37 @@ var Stats = Backbone.Model.extend({
 });
 window.stats = new Stats;
 
+var severityRanks = {"info": 1, "low": 2, "medium": 3, "high": 4, "critical": 5};
+var confidenceRanks = {"low": 1, "medium": 2, "high": 3};
+
 var Finding = Backbone.Model.extend({
     idAttribute: "ID",
+    severityRank: function () {
+        return severityRanks[this.get("Severity")] || 0;
+    },
+    confidenceRank: function () {
+        return confidenceRanks[this.get("Confidence")] || 0;
+    },
+    triageStatus: function () {
+        var triage = this.get("Triage");
+        return triage && triage.Status ? triage.Status : "untriaged";
+    },
+    saveTriage: function (triage, callback, error) {
+        $.ajax({
+            url: "/triage/" + encodeURIComponent(this.get("Fingerprint")),
+            method: "PUT",
+            contentType: "application/json",
+            data: JSON.stringify(triage),
+            success: _.bind(function (data) {
+                // findings with the same fingerprint share the triage
+                findings.where({Fingerprint: this.get("Fingerprint")}).forEach(function (finding) {
+                    finding.set("Triage", data.Status == "untriaged" && !data.Assignee && !data.Notes ? null : data);
+                });
+                callback(data);
+            }, this),
+            error: error
+        });
+    },
     testFileIndicators: ["test", "_spec", "fixture", "mock", "stub", "fake", "demo", "sample"],
     shortCommitHash: function () {
         return this.get("CommitHash").substr(0, 7);
@@ -53,6 +82,50 @@ var Finding = Backbone.Model.extend({
         }
         return false;
     },
+    keyDescription: function () {
+        var key = this.get("KeyMetadata");
+        if (!key) {
+            return "";
+        }
+        var parts = [];
+        if (key.Algorithm) {
+            parts.push(key.Bits > 0 ? key.Algorithm + " " + key.Bits + "-bit" : key.Algorithm);
+        }
+        if (!key.Valid) {
+            parts.push("invalid key");
+        } else if (key.Private) {
+            parts.push("private key");
+        } else {
+            parts.push("public key");
+        }
+        if (key.Format) {
+            parts.push("(" + key.Format + ")");
+        }
+        if (key.Encrypted) {
+            parts.push("encrypted");
+        }
+        return parts.join(" ");
+    },
+    jwtDescription: function () {
+        var jwt = this.get("JWT");
+        if (!jwt) {
+            return "";
+        }
+        var parts = ["alg " + jwt.Algorithm + (jwt.Unsigned ? " (unsigned)" : "")];
+        if (jwt.Issuer) {
+            parts.push("iss " + jwt.Issuer);
+        }
+        if (jwt.Subject) {
+            parts.push("sub " + jwt.Subject);
+        }
+        if (jwt.Audience) {
+            parts.push("aud " + jwt.Audience.join(","));
+        }
+        if (jwt.ExpiresAt) {
+            parts.push("exp " + jwt.ExpiresAt + (jwt.Expired ? " (expired)" : ""));
+        }
+        return parts.join(", ");
+    },
     fileContentsUrl: function () {
         return ["/files", this.get("RepositoryOwner"), this.get("RepositoryName"), this.get("CommitHash"), this.get("FilePath")].join("/");
     },
@@ -94,6 +167,9 @@ var StatsView = Backbone.View.extend({
         if (this.model.hasChanged("Findings")) {
             this.updateFindings();
         }
+        if (this.model.hasChanged("Suppressed")) {
+            this.updateSuppressed();
+        }
         if (this.model.hasChanged("Files")) {
             this.updateFiles();
         }
@@ -142,6 +218,12 @@ var StatsView = Backbone.View.extend({
     updateFindings: function () {
         $("#card_findings_value").hide().text(this.model.get("Findings").toLocaleString()).fadeIn("fast");
     },
+    updateSuppressed: function () {
+        var suppressed = this.model.get("Suppressed") || 0;
+        var desc = suppressed > 0 ? "Findings (" + suppressed.toLocaleString() + " suppressed)" : "Findings";
+        $("#card_findings_desc").text(desc);
+        $("#card_findings_desc").attr("title", suppressed > 0 ? "Suppressed findings are listed at /suppressions" : "");
+    },
     updateFiles: function () {
         $("#card_files_value").hide().text(this.model.get("Files").toLocaleString()).fadeIn("fast");
     },
@@ -189,8 +271,23 @@ var FindingView = Backbone.View.extend({
         if (this.model.isTestRelated()) {
             this.$el.addClass("test-related");
         }
+        if (this.model.get("Downgraded")) {
+            this.$el.addClass("downgraded");
+        }
         return this;
     },
+    severityClass: function () {
+        switch (this.model.get("Severity")) {
+            case "critical":
+                return "badge-danger";
+            case "high":
+                return "badge-warning";
+            case "medium":
+                return "badge-info";
+            default:
+                return "badge-secondary";
+        }
+    },
     formattedFilePath: function () {
         var splits = this.model.get("FilePath").split("/");
         var filename = splits.pop();
@@ -231,10 +328,16 @@ var FindingsView = Backbone.View.extend({
     collection: findings,
     initialize: function () {
         this.listenTo(this.collection, "add", this.renderFinding);
+        this.listenTo(this.collection, "change:Triage", this.rerenderFinding);
         this.listenTo(stats, "change:Findings", _.debounce(this.update, 500));
         $("#findings_search").on("keyup", _.debounce(this.searchFindings, 200));
+        $("#findings_min_severity, #findings_min_confidence, #findings_status").on("change", this.searchFindings);
+        $("#findings_sort_severity").on("click", this.sortFindings);
         $("#finding_modal").on("show.bs.modal", function (event) {
             $(document).on("keydown", function (e) {
+                if ($(e.target).is("input, textarea, select")) {
+                    return;
+                }
                 switch (e.keyCode) {
                     case 37:
                         var finding = findingsView.previousFinding();
@@ -270,6 +373,16 @@ var FindingsView = Backbone.View.extend({
         var findingEl = new FindingView({model: finding}).render().el;
         $(findingEl).appendTo(this.$el);
     },
+    rerenderFinding: function (finding) {
+        this.$el.find("tr").each(function () {
+            if ($(this).data("finding") === finding) {
+                var selected = $(this).hasClass("table-selected");
+                var findingEl = $(new FindingView({model: finding}).render().el).toggleClass("table-selected", selected);
+                $(this).replaceWith(findingEl);
+            }
+        });
+        this.searchFindings();
+    },
     activeFinding: function () {
         return this.$el.find("tr.table-selected");
     },
@@ -281,20 +394,31 @@ var FindingsView = Backbone.View.extend({
     },
     searchFindings: function () {
         var needle = $.trim($("#findings_search").val()).toLowerCase();
-        if (needle == "") {
-            $("#table_findings tbody tr").removeClass("d-none");
-            return;
-        }
+        var minSeverity = severityRanks[$("#findings_min_severity").val()] || 0;
+        var minConfidence = confidenceRanks[$("#findings_min_confidence").val()] || 0;
+        var status = $("#findings_status").val();
         $("#table_findings tbody tr").each(function () {
+            var finding = $(this).data("finding");
             var path = $(this).find("td.col-path").text().toLowerCase();
             var commit = $(this).find("td.col-commit").text().toLowerCase();
             var repository = $(this).find("td.col-repository").text().toLowerCase();
-            if (path.indexOf(needle) > -1 || commit.indexOf(needle) > -1 || repository.indexOf(needle) > -1) {
+            var found = needle == "" || path.indexOf(needle) > -1 || commit.indexOf(needle) > -1 || repository.indexOf(needle) > -1;
+            if (found && finding.severityRank() >= minSeverity && finding.confidenceRank() >= minConfidence &&
+                (status == "" || finding.triageStatus() == status)) {
                 $(this).removeClass("d-none");
             } else {
                 $(this).addClass("d-none");
             }
         });
+    },
+    sortFindings: function (e) {
+        e.preventDefault();
+        var rows = $("#table_findings tbody tr").get();
+        rows.sort(function (a, b) {
+            var x = $(a).data("finding"), y = $(b).data("finding");
+            return (y.severityRank() - x.severityRank()) || (y.confidenceRank() - x.confidenceRank());
+        });
+        $("#table_findings tbody").append(rows);
     }
 });
 window.findingsView = new FindingsView({el: "#table_findings tbody"});
@@ -315,6 +439,7 @@ var FindingModal = Backbone.View.extend({
     events: {
         "click #finding_view_raw": "showRawContents",
         "click #finding_view_hexdump": "showHexDumpContents",
+        "submit #finding_triage_form": "saveTriage",
     },
     render: function () {
         this.$el.html(this.template(this.model.attributes));
@@ -335,6 +460,19 @@ var FindingModal = Backbone.View.extend({
         $("#modal_file_contents").hide();
         $("#modal_file_hexdump").show();
     },
+    saveTriage: function (e) {
+        e.preventDefault();
+        this.model.saveTriage({
+            Status: $("#finding_triage_status").val(),
+            Assignee: $.trim($("#finding_triage_assignee").val()),
+            Notes: $.trim($("#finding_triage_notes").val())
+        }, function () {
+            $("#finding_triage_result").text("Saved");
+        }, function (xhr) {
+            var message = xhr.responseJSON ? xhr.responseJSON.message : xhr.statusText;
+            $("#finding_triage_result").text("Error: " + message);
+        });
+    },
     getHostName: function () {
         if (this.model.get("CommitURL").indexOf("github") !== -1) return "Github";
         return "GitLab";
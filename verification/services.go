@@ -0,0 +1,223 @@
+package verification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	githubTokenRegex   = regexp.MustCompile(`gh[pousr]_[0-9a-zA-Z]{36,251}|[0-9a-zA-Z]{35,40}`)
+	gitlabTokenRegex   = regexp.MustCompile(`glpat-[0-9a-zA-Z_\-]{20}|[0-9a-zA-Z_\-]{20}`)
+	slackTokenRegex    = regexp.MustCompile(`xox[pboa]-[0-9A-Za-z\-]+`)
+	slackWebhookRegex  = regexp.MustCompile(`https://hooks\.slack\.com(/services/T[a-zA-Z0-9_]+/B[a-zA-Z0-9_]+/[a-zA-Z0-9_]+)`)
+	credentialURLRegex = regexp.MustCompile(`https?://[^/\s:@]+:[^/\s:@]+@[^\s"'<>]+`)
+)
+
+func lastMatch(r *regexp.Regexp, s string) (string, bool) {
+	matches := r.FindAllString(s, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+	return matches[len(matches)-1], true
+}
+
+// maxResponseSize caps how much of a response body is read, verifiers only
+// need the start of it.
+const maxResponseSize = 1 << 20
+
+func doRequest(client *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	return resp, body, err
+}
+
+type githubTokenVerifier struct{}
+
+func (githubTokenVerifier) DefaultBaseURL() string {
+	return "https://api.github.com"
+}
+
+func (githubTokenVerifier) Extract(match string) (string, bool) {
+	return lastMatch(githubTokenRegex, match)
+}
+
+func (githubTokenVerifier) Verify(ctx context.Context, client *http.Client, baseURL, secret string) (string, error) {
+	req, err := newRequest(ctx, http.MethodGet, baseURL+"/user", nil)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	req.Header.Set("Authorization", "token "+secret)
+	resp, _, err := doRequest(client, req)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	return statusFromResponse(resp), nil
+}
+
+type gitlabTokenVerifier struct{}
+
+func (gitlabTokenVerifier) DefaultBaseURL() string {
+	return "https://gitlab.com"
+}
+
+func (gitlabTokenVerifier) Extract(match string) (string, bool) {
+	return lastMatch(gitlabTokenRegex, match)
+}
+
+func (gitlabTokenVerifier) Verify(ctx context.Context, client *http.Client, baseURL, secret string) (string, error) {
+	req, err := newRequest(ctx, http.MethodGet, baseURL+"/api/v4/user", nil)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", secret)
+	resp, _, err := doRequest(client, req)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	return statusFromResponse(resp), nil
+}
+
+type slackTokenVerifier struct{}
+
+func (slackTokenVerifier) DefaultBaseURL() string {
+	return "https://slack.com"
+}
+
+func (slackTokenVerifier) Extract(match string) (string, bool) {
+	return lastMatch(slackTokenRegex, match)
+}
+
+func (slackTokenVerifier) Verify(ctx context.Context, client *http.Client, baseURL, secret string) (string, error) {
+	req, err := newRequest(ctx, http.MethodPost, baseURL+"/api/auth.test", nil)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	req.Header.Set("Authorization", "Bearer "+secret)
+	resp, body, err := doRequest(client, req)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusFromResponse(resp), nil
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return StatusUnknown, err
+	}
+	switch {
+	case result.OK:
+		return StatusValid, nil
+	case result.Error == "invalid_auth" || result.Error == "account_inactive" || result.Error == "token_revoked":
+		return StatusInvalid, nil
+	default:
+		return StatusUnknown, nil
+	}
+}
+
+type slackWebhookVerifier struct{}
+
+func (slackWebhookVerifier) DefaultBaseURL() string {
+	return "https://hooks.slack.com"
+}
+
+// Extract keeps only the path of the webhook so that it can be sent to the
+// configured base URL.
+func (slackWebhookVerifier) Extract(match string) (string, bool) {
+	m := slackWebhookRegex.FindStringSubmatch(match)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Verify posts an empty message, which Slack rejects without delivering it.
+// A live webhook complains about the missing text, a dead one about the token.
+func (slackWebhookVerifier) Verify(ctx context.Context, client *http.Client, baseURL, secret string) (string, error) {
+	req, err := newRequest(ctx, http.MethodPost, baseURL+secret, strings.NewReader("{}"))
+	if err != nil {
+		return StatusUnknown, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, body, err := doRequest(client, req)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "text"):
+		return StatusValid, nil
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return StatusInvalid, nil
+	default:
+		return StatusUnknown, nil
+	}
+}
+
+type basicAuthVerifier struct{}
+
+// DefaultBaseURL is empty because the host is taken from the matched URL.
+func (basicAuthVerifier) DefaultBaseURL() string {
+	return ""
+}
+
+func (basicAuthVerifier) Extract(match string) (string, bool) {
+	return lastMatch(credentialURLRegex, match)
+}
+
+// Verify requests the matched URL with its credentials. When a base URL is
+// configured, the scheme and host of the matched URL are replaced by it.
+func (basicAuthVerifier) Verify(ctx context.Context, client *http.Client, baseURL, secret string) (string, error) {
+	target, err := url.Parse(secret)
+	if err != nil || target.User == nil {
+		return StatusUnknown, err
+	}
+	if baseURL != "" {
+		base, err := url.Parse(baseURL)
+		if err != nil {
+			return StatusUnknown, err
+		}
+		target.Scheme = base.Scheme
+		target.Host = base.Host
+	}
+	password, _ := target.User.Password()
+	username := target.User.Username()
+	target.User = nil
+
+	// credentials can only be judged when the resource actually requires them
+	req, err := newRequest(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	resp, _, err := doRequest(client, req)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if statusFromResponse(resp) != StatusInvalid {
+		return StatusUnknown, nil
+	}
+
+	req, err = newRequest(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	req.SetBasicAuth(username, password)
+	resp, _, err = doRequest(client, req)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	return statusFromResponse(resp), nil
+}
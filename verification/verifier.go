@@ -0,0 +1,151 @@
+package verification
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitrob/common"
+	"gitrob/matching"
+)
+
+const (
+	StatusValid   = "valid"
+	StatusInvalid = "invalid"
+	StatusUnknown = "unknown"
+
+	DefaultTimeout = 10 * time.Second
+
+	// MatcherName identifies verification in -disable-signature.
+	MatcherName = "verification"
+)
+
+type Verifier interface {
+	// Extract returns the secret to verify from the text matched by a signature.
+	Extract(match string) (string, bool)
+	// Verify checks the secret against the service found at baseURL.
+	Verify(ctx context.Context, client *http.Client, baseURL, secret string) (string, error)
+	DefaultBaseURL() string
+}
+
+var registry = map[string]Verifier{
+	"github-token":    githubTokenVerifier{},
+	"gitlab-pat":      gitlabTokenVerifier{},
+	"slack-token":     slackTokenVerifier{},
+	"slack-webhook":   slackWebhookVerifier{},
+	"http-basic-auth": basicAuthVerifier{},
+}
+
+func Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type Verifiers struct {
+	sync.Mutex
+
+	client   *http.Client
+	baseURLs map[string]string
+	cache    map[[sha256.Size]byte]string
+}
+
+// NewVerifiers configures the verifiers. baseURLs maps verifier names to the
+// URL of the service to verify against and falls back to the real service for
+// verifiers that are not listed.
+func NewVerifiers(baseURLs map[string]string, timeout time.Duration) (*Verifiers, error) {
+	for name := range baseURLs {
+		if _, ok := registry[name]; !ok {
+			return nil, fmt.Errorf("unknown verifier %s, available verifiers: %s", name, strings.Join(Names(), ", "))
+		}
+	}
+	return &Verifiers{
+		client:   &http.Client{Timeout: timeout},
+		baseURLs: baseURLs,
+		cache:    make(map[[sha256.Size]byte]string),
+	}, nil
+}
+
+// Verify determines whether the secret contained in match is live. Results are
+// cached, so a secret repeated across many commits is only sent once.
+func (v *Verifiers) Verify(name, match string) (string, error) {
+	verifier, ok := registry[name]
+	if !ok {
+		return StatusUnknown, fmt.Errorf("unknown verifier: %s", name)
+	}
+	secret, ok := verifier.Extract(match)
+	if !ok {
+		return StatusUnknown, nil
+	}
+
+	key := sha256.Sum256([]byte(name + "\x00" + secret))
+	v.Lock()
+	status, cached := v.cache[key]
+	v.Unlock()
+	if cached {
+		return status, nil
+	}
+
+	baseURL, ok := v.baseURLs[name]
+	if !ok {
+		baseURL = verifier.DefaultBaseURL()
+	}
+	status, err := verifier.Verify(context.Background(), v.client, strings.TrimSuffix(baseURL, "/"), secret)
+	if err != nil {
+		return StatusUnknown, err
+	}
+
+	v.Lock()
+	v.cache[key] = status
+	v.Unlock()
+	return status, nil
+}
+
+// Name makes the verifiers a matching.Inspector that verifies matches of
+// signatures naming a verifier.
+func (v *Verifiers) Name() string {
+	return MatcherName
+}
+
+// Match reports nothing, secrets are found by signatures.
+func (v *Verifiers) Match(*matching.File) ([]matching.Match, error) {
+	return nil, nil
+}
+
+func (v *Verifiers) Inspect(file *matching.File, match *matching.Match) error {
+	if match.Verifier == "" {
+		return nil
+	}
+	var err error
+	match.VerificationStatus, err = v.Verify(match.Verifier, match.Text)
+	return err
+}
+
+func newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", common.UserAgent)
+	return req, nil
+}
+
+func statusFromResponse(resp *http.Response) string {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return StatusValid
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return StatusInvalid
+	default:
+		return StatusUnknown
+	}
+}